@@ -0,0 +1,68 @@
+package jhttp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// auth.go is used to authorize requests with bearer tokens
+
+type tokenRejectedKey struct{}
+
+// WithBearerToken sends token as the bearer token of every request, it
+// overrides the Authorization header and WithBasicAuth of the client. An
+// Authorization set by WithReqHeader or WithReqBasicAuth overrides it for a
+// single request.
+func WithBearerToken(token string) ClientOption {
+	return WithTokenProvider(func(context.Context) (string, error) {
+		return token, nil
+	})
+}
+
+// WithTokenProvider is WithBearerToken with a token returned by provider,
+// which is called before every attempt and may cache the token. A request
+// fails without being sent when provider fails.
+func WithTokenProvider(provider func(ctx context.Context) (string, error)) ClientOption {
+	return func(client *Client) {
+		client.tokenProvider = provider
+	}
+}
+
+// WithRefreshTokenOnUnauthorized sends a request rejected with a 401 once
+// more, with a token the provider is asked to refresh, see TokenRejected.
+// That attempt is not counted as a retry.
+func WithRefreshTokenOnUnauthorized() ClientOption {
+	return func(client *Client) {
+		client.refreshTokenOnUnauthorized = true
+	}
+}
+
+// TokenRejected reports whether the token provider is called because the
+// previous token was rejected with a 401, a caching provider must then return
+// a fresh token.
+func TokenRejected(ctx context.Context) bool {
+	rejected, _ := ctx.Value(tokenRejectedKey{}).(bool)
+	return rejected
+}
+
+// token returns the bearer token of the next attempt, if any.
+func (c *Client) token(ctx context.Context, rejected bool) (string, error) {
+	if c.tokenProvider == nil {
+		return "", nil
+	}
+	if rejected {
+		ctx = context.WithValue(ctx, tokenRejectedKey{}, true)
+	}
+	token, err := c.tokenProvider(ctx)
+	if err != nil {
+		return "", fmt.Errorf("token provider: %w", err)
+	}
+	return token, nil
+}
+
+// refreshToken reports whether the token is refreshed after the failed
+// attempt, see WithRefreshTokenOnUnauthorized.
+func (c *Client) refreshToken(attempt Attempt) bool {
+	return c.refreshTokenOnUnauthorized && c.tokenProvider != nil && attempt.StatusCode == http.StatusUnauthorized
+}
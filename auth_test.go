@@ -0,0 +1,92 @@
+package jhttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBearerToken(t *testing.T) {
+	count := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count++
+		_, _ = w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer server.Close()
+
+	client := NewClient(WithBasicAuth("user", "pass"), WithBearerToken("static"))
+	resp, err := client.Get(server.URL, nil)
+	require.Nil(t, err)
+	require.Equal(t, "Bearer static", resp.String())
+	resp, err = client.Get(server.URL, nil, WithReqHeader("Authorization", "Bearer request"))
+	require.Nil(t, err)
+	require.Equal(t, "Bearer request", resp.String())
+
+	// a failing provider fails the request before it is sent
+	count = 0
+	client = NewClient(SetRetry(2), WithTokenProvider(func(ctx context.Context) (string, error) {
+		return "", errors.New("no token")
+	}))
+	_, err = client.Get(server.URL, nil)
+	require.ErrorContains(t, err, "token provider: no token")
+	require.Equal(t, 0, count)
+}
+
+func TestRefreshTokenOnUnauthorized(t *testing.T) {
+	count := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count++
+		if r.Header.Get("Authorization") != "Bearer token2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	// the cached token expired on the server
+	var refreshes, version int
+	provider := func(ctx context.Context) (string, error) {
+		if version == 0 || TokenRejected(ctx) {
+			refreshes++
+			version++
+		}
+		return "token" + strconv.Itoa(version), nil
+	}
+
+	client := NewClient(SetRetry(2), WithTokenProvider(provider), WithRefreshTokenOnUnauthorized())
+	sleeps := recordSleeps(client)
+	resp, err := client.Get(server.URL, nil)
+	require.Nil(t, err)
+	require.Equal(t, "ok", resp.String())
+	require.Equal(t, 2, count)
+	require.Equal(t, 2, refreshes)
+	require.Equal(t, 2, resp.Attempts())
+	require.Empty(t, *sleeps)
+
+	// the refreshed token is used from now on
+	resp, err = client.Get(server.URL, nil)
+	require.Nil(t, err)
+	require.Equal(t, 3, count)
+	require.Equal(t, 2, refreshes)
+
+	// a rejected refreshed token is only sent once
+	count, refreshes, version = 0, 0, 5
+	_, err = client.Get(server.URL, nil)
+	var statusErr *StatusError
+	require.ErrorAs(t, err, &statusErr)
+	require.Equal(t, http.StatusUnauthorized, statusErr.Code)
+	require.Equal(t, 2, count)
+	require.Equal(t, 1, refreshes)
+
+	// without the option a 401 is returned at once
+	count, version = 0, 0
+	_, err = NewClient(WithTokenProvider(provider)).Get(server.URL, nil)
+	require.ErrorAs(t, err, &statusErr)
+	require.Equal(t, 1, count)
+}
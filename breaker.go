@@ -0,0 +1,162 @@
+package jhttp
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// breaker.go is used to fail fast while a host keeps failing
+
+// CircuitState is the state of the circuit breaker of a host.
+type CircuitState int
+
+const (
+	// CircuitClosed lets every request through.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen fails every request with ErrCircuitOpen.
+	CircuitOpen
+	// CircuitHalfOpen lets a single probe request through.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("CircuitState(%d)", int(s))
+}
+
+// WithCircuitBreaker opens the circuit of a host after threshold consecutive
+// failed attempts, requests to it then fail with ErrCircuitOpen without being
+// sent. After cooldown a single probe is let through, its success closes the
+// circuit and its failure opens it again. A failure is an attempt the client
+// would retry, see WithRetryCondition.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) ClientOption {
+	return func(client *Client) {
+		if threshold < 1 || cooldown <= 0 {
+			client.invalidOption("WithCircuitBreaker", "invalid threshold %d or cooldown %s", threshold, cooldown)
+			return
+		}
+		client.breaker = &circuitBreaker{threshold: threshold, cooldown: cooldown, circuits: map[string]*circuit{}}
+	}
+}
+
+// WithOnCircuitChange calls hook every time the circuit of a host changes
+// state, e.g. to count the opened circuits.
+func WithOnCircuitChange(hook func(host string, from, to CircuitState)) ClientOption {
+	return func(client *Client) {
+		client.onCircuitChange = hook
+	}
+}
+
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	mu        sync.Mutex
+	circuits  map[string]*circuit
+}
+
+type circuit struct {
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	// probing is set while the half-open probe is in flight
+	probing bool
+}
+
+// allowCircuit returns ErrCircuitOpen unless an attempt to host may be sent.
+func (c *Client) allowCircuit(host string) error {
+	if c.breaker == nil {
+		return nil
+	}
+	b := c.breaker
+	b.mu.Lock()
+	cb := b.circuit(host)
+	from := cb.state
+	switch cb.state {
+	case CircuitOpen:
+		if c.clock().Sub(cb.openedAt) < b.cooldown {
+			b.mu.Unlock()
+			return fmt.Errorf("%w: %s", ErrCircuitOpen, host)
+		}
+		cb.state, cb.probing = CircuitHalfOpen, true
+	case CircuitHalfOpen:
+		if cb.probing {
+			b.mu.Unlock()
+			return fmt.Errorf("%w: %s", ErrCircuitOpen, host)
+		}
+		cb.probing = true
+	}
+	to := cb.state
+	b.mu.Unlock()
+	c.notifyCircuit(host, from, to)
+	return nil
+}
+
+// recordCircuit records the outcome of an attempt to host, failed when it is
+// retryable. A cancelled attempt, or one never sent, see finalFailure, is
+// neither a success nor a failure.
+func (c *Client) recordCircuit(host string, cancelled, failed bool) {
+	if c.breaker == nil {
+		return
+	}
+	b := c.breaker
+	b.mu.Lock()
+	cb := b.circuit(host)
+	from := cb.state
+	switch {
+	case cb.state == CircuitHalfOpen:
+		cb.probing = false
+		if cancelled {
+			break
+		}
+		if failed {
+			cb.state, cb.openedAt = CircuitOpen, c.clock()
+		} else {
+			cb.state, cb.failures = CircuitClosed, 0
+		}
+	case cb.state == CircuitClosed && !cancelled:
+		if !failed {
+			cb.failures = 0
+			break
+		}
+		cb.failures++
+		if cb.failures >= b.threshold {
+			cb.state, cb.openedAt = CircuitOpen, c.clock()
+		}
+	}
+	to := cb.state
+	b.mu.Unlock()
+	c.notifyCircuit(host, from, to)
+}
+
+// circuit returns the circuit of host, b.mu must be held.
+func (b *circuitBreaker) circuit(host string) *circuit {
+	cb, ok := b.circuits[host]
+	if !ok {
+		cb = &circuit{}
+		b.circuits[host] = cb
+	}
+	return cb
+}
+
+// notifyCircuit calls the OnCircuitChange hook when the state changed, a panic
+// in the hook is logged.
+func (c *Client) notifyCircuit(host string, from, to CircuitState) {
+	if c.onCircuitChange == nil || from == to {
+		return
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("jhttp: recovered panic in OnCircuitChange hook: %v", p)
+		}
+	}()
+	c.onCircuitChange(host, from, to)
+}
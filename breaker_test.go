@@ -0,0 +1,179 @@
+package jhttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var status, count int32 = http.StatusServiceUnavailable, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+
+	now := time.Now()
+	var changes []string
+	client := NewClient(WithCircuitBreaker(2, time.Minute), WithOnCircuitChange(func(host string, from, to CircuitState) {
+		require.Equal(t, u.Host, host)
+		changes = append(changes, fmt.Sprintf("%s->%s", from, to))
+	}))
+	client.now = func() time.Time {
+		return now
+	}
+
+	// two failures open the circuit
+	for i := 0; i < 2; i++ {
+		_, err := client.Get(server.URL, nil)
+		require.NotErrorIs(t, err, ErrCircuitOpen)
+	}
+	_, err := client.Get(server.URL, nil)
+	require.ErrorIs(t, err, ErrCircuitOpen)
+	require.Equal(t, int32(2), atomic.LoadInt32(&count))
+	require.Equal(t, []string{"closed->open"}, changes)
+
+	// a failed probe opens it again
+	now = now.Add(time.Minute)
+	_, err = client.Get(server.URL, nil)
+	require.NotErrorIs(t, err, ErrCircuitOpen)
+	_, err = client.Get(server.URL, nil)
+	require.ErrorIs(t, err, ErrCircuitOpen)
+	require.Equal(t, int32(3), atomic.LoadInt32(&count))
+	require.Equal(t, []string{"closed->open", "open->half-open", "half-open->open"}, changes)
+
+	// a successful probe closes it
+	now = now.Add(time.Minute)
+	atomic.StoreInt32(&status, http.StatusOK)
+	_, err = client.Get(server.URL, nil)
+	require.Nil(t, err)
+	_, err = client.Get(server.URL, nil)
+	require.Nil(t, err)
+	require.Equal(t, int32(5), atomic.LoadInt32(&count))
+	require.Equal(t, []string{"closed->open", "open->half-open", "half-open->open", "open->half-open", "half-open->closed"}, changes)
+}
+
+func TestCircuitBreakerRetry(t *testing.T) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	// a 404 is not a failure of the host
+	client := NewClient(SetRetry(5), WithCircuitBreaker(1, time.Minute))
+	recordSleeps(client)
+	for i := 0; i < 3; i++ {
+		_, err := client.Get(server.URL+"/missing", nil)
+		require.NotErrorIs(t, err, ErrCircuitOpen)
+	}
+	// the open circuit stops the retries
+	_, err := client.Get(server.URL, nil)
+	require.ErrorIs(t, err, ErrCircuitOpen)
+	require.Equal(t, int32(4), atomic.LoadInt32(&count))
+
+	require.NotNil(t, NewClient(WithCircuitBreaker(0, time.Second)).Validate())
+}
+
+func TestCircuitBreakerConcurrent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := NewClient(WithCircuitBreaker(5, time.Minute))
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = client.Get(server.URL, nil)
+		}()
+	}
+	wg.Wait()
+	_, err := client.Get(server.URL, nil)
+	require.ErrorIs(t, err, ErrCircuitOpen)
+}
+
+func TestCircuitBreakerTokenFailure(t *testing.T) {
+	var status int32 = http.StatusServiceUnavailable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer server.Close()
+
+	var tokenErr error
+	now := time.Now()
+	client := NewClient(WithCircuitBreaker(1, time.Minute), WithTokenProvider(func(context.Context) (string, error) {
+		if tokenErr != nil {
+			return "", tokenErr
+		}
+		return "t1", nil
+	}))
+	client.now = func() time.Time {
+		return now
+	}
+	_, err := client.Get(server.URL, nil)
+	require.NotErrorIs(t, err, ErrCircuitOpen)
+
+	// a token failure during the half-open probe does not keep the probe
+	now = now.Add(time.Minute)
+	errToken := errors.New("token unavailable")
+	tokenErr = errToken
+	_, err = client.Get(server.URL, nil)
+	require.ErrorIs(t, err, errToken)
+
+	tokenErr = nil
+	atomic.StoreInt32(&status, http.StatusOK)
+	_, err = client.Get(server.URL, nil)
+	require.Nil(t, err)
+	_, err = client.Get(server.URL, nil)
+	require.Nil(t, err)
+}
+
+func TestCircuitBreakerRetryCondition(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-r.Context().Done()
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	var errs []error
+	client := NewClient(SetRetry(2), WithCircuitBreaker(10, time.Minute), WithRetryCondition(func(resp *Result, err error) bool {
+		errs = append(errs, err)
+		return true
+	}))
+	recordSleeps(client)
+
+	// called once for every failed attempt
+	_, err := client.Get(server.URL, nil)
+	require.NotNil(t, err)
+	require.Len(t, errs, 3)
+
+	// and never for a cancelled one
+	errs = nil
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_, err = client.Get(server.URL+"/slow", nil, WithRequestContext(ctx))
+	require.ErrorIs(t, err, context.Canceled)
+	require.Len(t, errs, 0)
+}
@@ -0,0 +1,85 @@
+package jhttp
+
+import (
+	"context"
+	"time"
+)
+
+// RequestBuilder composes a one-off request, it is cheap to create and must
+// not be shared between goroutines.
+type RequestBuilder struct {
+	client *Client
+	body   any
+	opts   []ParamsOption
+}
+
+func (c *Client) R() *RequestBuilder {
+	return &RequestBuilder{client: c}
+}
+
+func (b *RequestBuilder) SetHeader(key, value string) *RequestBuilder {
+	b.opts = append(b.opts, WithReqHeader(key, value))
+	return b
+}
+
+func (b *RequestBuilder) SetQuery(key, value string) *RequestBuilder {
+	b.opts = append(b.opts, AddParams(key, value))
+	return b
+}
+
+func (b *RequestBuilder) SetAuthToken(token string) *RequestBuilder {
+	return b.SetHeader("Authorization", "Bearer "+token)
+}
+
+func (b *RequestBuilder) SetBody(body any) *RequestBuilder {
+	b.body = body
+	return b
+}
+
+func (b *RequestBuilder) SetContext(ctx context.Context) *RequestBuilder {
+	b.opts = append(b.opts, WithRequestContext(ctx))
+	return b
+}
+
+func (b *RequestBuilder) SetTimeout(timeout time.Duration) *RequestBuilder {
+	b.opts = append(b.opts, WithRequestTimeout(timeout))
+	return b
+}
+
+// SetOptions appends any other ParamsOption to the request.
+func (b *RequestBuilder) SetOptions(opts ...ParamsOption) *RequestBuilder {
+	b.opts = append(b.opts, opts...)
+	return b
+}
+
+func (b *RequestBuilder) Do(method, url string) (*Result, error) {
+	return b.client.Do(method, url, b.body, b.opts...)
+}
+
+func (b *RequestBuilder) Get(url string) (*Result, error) {
+	return b.Do("GET", url)
+}
+
+func (b *RequestBuilder) Post(url string) (*Result, error) {
+	return b.Do("POST", url)
+}
+
+func (b *RequestBuilder) Put(url string) (*Result, error) {
+	return b.Do("PUT", url)
+}
+
+func (b *RequestBuilder) Patch(url string) (*Result, error) {
+	return b.Do("PATCH", url)
+}
+
+func (b *RequestBuilder) Delete(url string) (*Result, error) {
+	return b.Do("DELETE", url)
+}
+
+func (b *RequestBuilder) Head(url string) (*Result, error) {
+	return b.Do("HEAD", url)
+}
+
+func (b *RequestBuilder) Options(url string) (*Result, error) {
+	return b.Do("OPTIONS", url)
+}
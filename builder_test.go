@@ -0,0 +1,43 @@
+package jhttp
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestBuilder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write([]byte(r.Method + " " + r.URL.RequestURI() + " " + r.Header.Get("X-Foo") + " " +
+			r.Header.Get("Authorization") + " " + string(body)))
+	}))
+	defer server.Close()
+	client := NewClient()
+
+	resp, err := client.R().
+		SetHeader("X-Foo", "bar").
+		SetQuery("page", "2").
+		SetQuery("size", "10").
+		SetAuthToken("token").
+		SetBody(MyStruct{Key: "k1", Value: "v1"}).
+		Post(server.URL + "/things")
+	require.Nil(t, err)
+	require.Equal(t, true, resp.Equal(`POST /things?page=2&size=10 bar Bearer token {"key":"k1","value":"v1"}`))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := client.R().SetHeader("X-Foo", "baz").Get(server.URL)
+			require.Nil(t, err)
+			require.Equal(t, true, resp.Equal("GET / baz  "))
+		}()
+	}
+	wg.Wait()
+}
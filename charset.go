@@ -0,0 +1,44 @@
+package jhttp
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// charset.go is used to convert response bodies to UTF-8
+
+var ErrUnsupportedCharset = errors.New("unsupported charset")
+
+// WithCharsetConversion converts buffered response bodies to UTF-8 using the
+// charset parameter of the response Content-Type, e.g. gbk or iso-8859-1.
+// Bodies without a charset are left as they are.
+func WithCharsetConversion() ClientOption {
+	return func(client *Client) {
+		client.charsetConversion = true
+	}
+}
+
+func (result *Result) convertCharset() error {
+	_, params, err := mime.ParseMediaType(result.Header("Content-Type"))
+	if err != nil || params["charset"] == "" {
+		return nil
+	}
+	name := params["charset"]
+	encoding, err := htmlindex.Get(name)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrUnsupportedCharset, name)
+	}
+	if canonical, _ := htmlindex.Name(encoding); canonical == "utf-8" {
+		return nil
+	}
+	data, err := encoding.NewDecoder().Bytes(result.cache)
+	if err != nil {
+		return fmt.Errorf("convert charset %s: %w", name, err)
+	}
+	result.cache = data
+	result.converted = true
+	return nil
+}
@@ -0,0 +1,58 @@
+package jhttp
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithCharsetConversion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/gbk":
+			w.Header().Set("Content-Type", "text/html; charset=gbk")
+			_, _ = w.Write([]byte{0xC4, 0xE3, 0xBA, 0xC3})
+		case "/latin1":
+			w.Header().Set("Content-Type", "application/json; charset=ISO-8859-1")
+			_, _ = w.Write([]byte{'"', 'c', 'a', 'f', 0xE9, '"'})
+		case "/xml":
+			w.Header().Set("Content-Type", "text/xml; charset=gbk")
+			_, _ = w.Write(append([]byte(`<?xml version="1.0" encoding="GBK"?><item><key>`), 0xC4, 0xE3, 0xBA, 0xC3, '<', '/', 'k', 'e', 'y', '>', '<', '/', 'i', 't', 'e', 'm', '>'))
+		default:
+			w.Header().Set("Content-Type", "text/plain; charset=x-unknown")
+			_, _ = w.Write([]byte("hello"))
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient()
+	resp, err := client.Get(server.URL+"/gbk", nil)
+	require.Nil(t, err)
+	require.Equal(t, []byte{0xC4, 0xE3, 0xBA, 0xC3}, resp.Bytes())
+
+	client = NewClient(WithCharsetConversion())
+	resp, err = client.Get(server.URL+"/gbk", nil)
+	require.Nil(t, err)
+	require.Equal(t, "你好", resp.String())
+
+	resp, err = client.Get(server.URL+"/latin1", nil)
+	require.Nil(t, err)
+	var s string
+	require.Nil(t, resp.JSON(&s))
+	require.Equal(t, "café", s)
+
+	resp, err = client.Get(server.URL+"/xml", nil)
+	require.Nil(t, err)
+	var item struct {
+		Key string `xml:"key"`
+	}
+	require.Nil(t, resp.XML(&item))
+	require.Equal(t, "你好", item.Key)
+
+	_, err = client.Get(server.URL+"/unknown", nil)
+	require.Equal(t, true, errors.Is(err, ErrUnsupportedCharset))
+	require.Contains(t, err.Error(), "x-unknown")
+}
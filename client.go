@@ -4,17 +4,44 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"net"
 	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
 
 	"github.com/gorilla/websocket"
 )
 
+// Version is the version of jhttp, sent in the default User-Agent.
+const Version = "0.1.0"
+
+const defaultUserAgent = "jhttp/" + Version
+
 type ClientOption = func(*Client)
 
-type ParamsOption = func() string
+type ParamsOption = func(*request)
+
+// ContentTypeData wraps a request body to send it with the given Content-Type,
+// overriding any Content-Type header set on the client. FormData bodies always
+// keep their multipart Content-Type.
+type ContentTypeData struct {
+	ContentType string
+	Data        any
+}
 
+// Client sends requests, it is safe for concurrent use by multiple goroutines
+// like http.Client. The options configure it in NewClient only, afterwards
+// just the cookie methods change it and they may be called while requests are
+// in flight.
 type Client struct {
 	ctx       context.Context
 	http      *http.Client
@@ -22,70 +49,641 @@ type Client struct {
 	header    map[string]string
 	cookie    []*http.Cookie
 	retry     int
+	baseURL   string
+	// generate an Idempotency-Key for every request
+	autoIdempotencyKey bool
+	// maximum size of a buffered response body, MaxReadSize when zero
+	maxResponseBytes int64
+	successCheck     func(*Result) bool
+	// convert response bodies to UTF-8
+	charsetConversion bool
+	// keep compressed response bodies as they are
+	rawContentEncoding bool
+	// return the Result of failed responses together with the error
+	returnResultOnError bool
+	// record a TraceInfo for every request
+	trace bool
+	// turn failed responses into custom errors
+	errorDecoder func(*Result) error
+	// bytes of a failed response body kept on a StatusError
+	maxErrorBodyBytes int64
+	// keep the query of request URLs in errors
+	fullURLInErrors bool
+	// successful status codes, 2xx and 304 when empty
+	successStatuses []statusRange
+	// redirects are not followed, 3xx responses are successful by default
+	noRedirects bool
+	// observe failed requests
+	onError func(ctx context.Context, method, url string, err error)
+	// onRequest and onResponse observe every attempt
+	onRequest  func(method, url string, header http.Header)
+	onResponse func(method, url string, status int, dur time.Duration)
+	// invalid options, reported by Validate
+	optionErrs []error
+	// backoff between retries, now, sleep and jitter are replaced in tests
+	retryWaitMin time.Duration
+	retryWaitMax time.Duration
+	sleep        func(context.Context, time.Duration) error
+	now          func() time.Time
+	backoff      func(attempt int, resp *Result, err error) time.Duration
+	jitter       func(int64) int64
+	// retry POST and PATCH requests without an idempotency key
+	retryNonIdempotent bool
+	retryCondition     func(resp *Result, err error) bool
+	maxElapsedTime     time.Duration
+	onRetry            func(info RetryInfo)
+	breaker            *circuitBreaker
+	onCircuitChange    func(host string, from, to CircuitState)
+	stats              *clientStats
+	// transport is the own clone configured by the TLS and pool options
+	transport         *http.Transport
+	disableKeepAlives bool
+	userAgent         string
+	// basic auth of every request, never part of errors or dumps
+	basicAuth *basicAuth
+	// tokenProvider returns the bearer token of every attempt
+	tokenProvider              func(ctx context.Context) (string, error)
+	refreshTokenOnUnauthorized bool
+	// resolver and dnsCache are used by the dialer of WithResolver and
+	// WithDNSCache
+	resolver *net.Resolver
+	dnsCache *dnsCache
+	// dialTimeout, unixSocket and localAddr are used by the dialer too
+	dialTimeout time.Duration
+	unixSocket  string
+	localAddr   net.IP
+	// hostOverride is sent as the Host of every request, and used as the TLS
+	// server name with the transports of hostTransports
+	hostOverride      string
+	noHostOverrideSNI bool
+	hostTransports    *hostTransports
+	// middlewares run in order on every attempt, responseMiddlewares on every
+	// response
+	middlewares         []func(req *http.Request) error
+	responseMiddlewares []func(resp *http.Response) error
+	// roundTripper is the transport wrapped by roundTripperMiddlewares, built
+	// after the options were applied
+	roundTripperMiddlewares []func(http.RoundTripper) http.RoundTripper
+	roundTripper            http.RoundTripper
+	// slots holds a value for every attempt in flight with WithMaxConcurrency
+	slots chan struct{}
+	// rateLimiter paces the attempts of WithRateLimit
+	rateLimiter *rateLimiter
+	// JSON codec of request bodies and results, encoding/json if nil
+	jsonMarshal   func(v any) ([]byte, error)
+	jsonUnmarshal func(data []byte, v any) error
+	// cookieMu guards cookie, which is replaced rather than modified, it
+	// is a pointer like stats so Clone can copy the client
+	cookieMu *sync.RWMutex
+}
+
+type statusRange struct {
+	lo, hi int
 }
 
 func NewClient(opts ...ClientOption) *Client {
-	client := &Client{http: http.DefaultClient, websocket: websocket.DefaultDialer, header: map[string]string{}, retry: 0}
+	client := &Client{
+		http:              &http.Client{},
+		websocket:         websocket.DefaultDialer,
+		header:            map[string]string{},
+		retry:             0,
+		maxErrorBodyBytes: defaultMaxErrorBodyBytes,
+		userAgent:         defaultUserAgent,
+		retryWaitMin:      defaultRetryWaitMin,
+		retryWaitMax:      defaultRetryWaitMax,
+		sleep:             sleepContext,
+		now:               time.Now,
+		jitter:            defaultJitter,
+		dialTimeout:       defaultDialTimeout,
+		stats:             &clientStats{},
+		cookieMu:          &sync.RWMutex{},
+		hostTransports:    &hostTransports{},
+	}
 	for _, opt := range opts {
 		opt(client)
 	}
+	client.buildRoundTripper()
 	return client
 }
 
+// zeroCookieMu guards the cookies of a Client not made by NewClient, such
+// clients share it.
+var zeroCookieMu sync.RWMutex
+
+// clock returns the current time, of the clock replaced in tests if set.
+func (c *Client) clock() time.Time {
+	if c.now == nil {
+		return time.Now()
+	}
+	return c.now()
+}
+
+// sleepFor waits for d unless ctx is done first, see sleepContext.
+func (c *Client) sleepFor(ctx context.Context, d time.Duration) error {
+	if c.sleep == nil {
+		return sleepContext(ctx, d)
+	}
+	return c.sleep(ctx, d)
+}
+
+// cookieLock returns the lock guarding the cookies of the client.
+func (c *Client) cookieLock() *sync.RWMutex {
+	if c.cookieMu == nil {
+		return &zeroCookieMu
+	}
+	return c.cookieMu
+}
+
 func WithContext(ctx context.Context) ClientOption {
 	return func(client *Client) {
+		if ctx == nil {
+			client.invalidOption("WithContext", "nil context")
+		}
 		client.ctx = ctx
 	}
 }
 
+// WithBaseURL sets the base URL that relative request URLs are resolved
+// against, a leading slash in the request path is relative to the base path
+// rather than the host root. Absolute request URLs bypass the base, a
+// scheme-relative one, "//host/path", only takes its scheme.
+func WithBaseURL(base string) ClientOption {
+	return func(client *Client) {
+		if err := validateBaseURL(base); err != nil {
+			client.invalidOption("WithBaseURL", "%v", err)
+		}
+		client.baseURL = base
+	}
+}
+
 func AddHeader(key, value string) ClientOption {
 	return func(client *Client) {
+		if !validHeaderKey(key) {
+			client.invalidOption("AddHeader", "invalid header key %q", key)
+		}
+		if !validHeaderValue(value) {
+			client.invalidOption("AddHeader", "invalid value for header %q", key)
+		}
 		client.header[key] = value
 	}
 }
 
+// ownHTTP returns the http.Client of the client, copying the shared
+// http.DefaultClient first so it is never modified.
+func (c *Client) ownHTTP() *http.Client {
+	if c.http == nil || c.http == http.DefaultClient {
+		httpClient := *http.DefaultClient
+		c.http = &httpClient
+	}
+	return c.http
+}
+
+// WithUserAgent sets the User-Agent of every request, jhttp/<Version> by
+// default. An empty ua sends no User-Agent at all. WithReqHeader overrides it
+// for a single request.
+func WithUserAgent(ua string) ClientOption {
+	return func(client *Client) {
+		client.userAgent = ua
+	}
+}
+
+// WithBasicAuth sets HTTP Basic auth for every request, it overrides the
+// Authorization header of the client. WithReqBasicAuth and an Authorization
+// header set by WithReqHeader override it for a single request.
+func WithBasicAuth(username, password string) ClientOption {
+	return func(client *Client) {
+		client.basicAuth = &basicAuth{username: username, password: password}
+	}
+}
+
+// SetTimeout sets the timeout of every attempt, it only changes the own
+// http.Client of this client and never http.DefaultClient.
 func SetTimeout(timeout time.Duration) ClientOption {
 	return func(client *Client) {
-		client.http.Timeout = timeout
+		client.ownHTTP().Timeout = timeout
+	}
+}
+
+// WithTransport sends the requests through rt instead of
+// http.DefaultTransport, e.g. an instrumented or stub RoundTripper. SetTimeout
+// and the redirect options still apply, they are enforced by the http.Client
+// around rt. The TLS and pool options given after it configure a copy of rt,
+// which must then be an *http.Transport.
+func WithTransport(rt http.RoundTripper) ClientOption {
+	return func(client *Client) {
+		if rt == nil {
+			client.invalidOption("WithTransport", "nil transport")
+			return
+		}
+		client.ownHTTP().Transport = rt
 	}
 }
 
+// SetRetry retries a failed request up to retry times. Only idempotent
+// methods and requests with an Idempotency-Key are retried unless
+// WithRetryNonIdempotent is set, so a POST or PATCH is sent once by default.
+// A 4xx status other than 408 and 429 is never retried, see
+// WithRetryCondition.
 func SetRetry(retry int) ClientOption {
 	return func(client *Client) {
 		client.retry = retry
+		if retry < 0 {
+			client.invalidOption("SetRetry", "negative retry count %d", retry)
+			client.retry = 0
+		}
+	}
+}
+
+// WithAutoIdempotencyKey generates an Idempotency-Key header for every
+// request, the same key is reused by all retry attempts of that request. A
+// request that already has a key, from WithIdempotencyKey or an
+// Idempotency-Key header of the request or the client, keeps it.
+func WithAutoIdempotencyKey() ClientOption {
+	return func(client *Client) {
+		client.autoIdempotencyKey = true
+	}
+}
+
+// WithMaxResponseBytes limits the size of buffered response bodies, larger
+// bodies fail with ErrResponseTooLarge instead of being truncated.
+func WithMaxResponseBytes(n int64) ClientOption {
+	return func(client *Client) {
+		client.maxResponseBytes = n
+	}
+}
+
+// WithMaxErrorBodyBytes sets how much of a failed response body is read and
+// kept on a StatusError or a failed Result, 64KiB by default. The rest of the
+// body is discarded and the StatusError is marked Truncated.
+func WithMaxErrorBodyBytes(n int64) ClientOption {
+	return func(client *Client) {
+		client.maxErrorBodyBytes = n
+		if n < 0 {
+			client.invalidOption("WithMaxErrorBodyBytes", "negative size %d", n)
+			client.maxErrorBodyBytes = 0
+		}
+	}
+}
+
+// WithFullURLInErrors keeps the query string of request URLs in errors, by
+// default errors only name the host and path since the query may hold secrets.
+func WithFullURLInErrors() ClientOption {
+	return func(client *Client) {
+		client.fullURLInErrors = true
+	}
+}
+
+// WithSuccessStatuses sets the successful status codes instead of the default
+// 2xx and 304, it adds up with WithSuccessRange.
+func WithSuccessStatuses(codes ...int) ClientOption {
+	return func(client *Client) {
+		for _, code := range codes {
+			client.successStatuses = append(client.successStatuses, statusRange{lo: code, hi: code})
+		}
+	}
+}
+
+// WithSuccessRange sets the successful status codes to lo through hi
+// inclusive instead of the default 2xx and 304, it adds up with
+// WithSuccessStatuses.
+func WithSuccessRange(lo, hi int) ClientOption {
+	return func(client *Client) {
+		if lo > hi {
+			client.invalidOption("WithSuccessRange", "empty range %d-%d", lo, hi)
+		}
+		client.successStatuses = append(client.successStatuses, statusRange{lo: lo, hi: hi})
+	}
+}
+
+// WithOnError calls hook once for every failed request, after the retries
+// are exhausted. The hook only observes the error, the url has its query
+// redacted like the error unless WithFullURLInErrors is set.
+func WithOnError(hook func(ctx context.Context, method, url string, err error)) ClientOption {
+	return func(client *Client) {
+		client.onError = hook
+	}
+}
+
+// WithSuccessCheck decides which responses are successful instead of the
+// default 2xx check, a rejected response is retried and then returned as an
+// error. The check is called with responses of any status.
+func WithSuccessCheck(check func(*Result) bool) ClientOption {
+	return func(client *Client) {
+		client.successCheck = check
+	}
+}
+
+// WithReturnResultOnError returns the Result of a failed response together
+// with the error, so the status, headers and body of 4xx and 5xx responses
+// can be inspected. Failed responses are still retried.
+func WithReturnResultOnError() ClientOption {
+	return func(client *Client) {
+		client.returnResultOnError = true
+	}
+}
+
+// WithErrorDecoder turns failed responses into the error returned by the
+// request, e.g. an API error envelope. When it returns nil the default error
+// is returned.
+func WithErrorDecoder(decoder func(*Result) error) ClientOption {
+	return func(client *Client) {
+		client.errorDecoder = decoder
 	}
 }
 
+// AddParams adds a raw query parameter, key and value are always escaped,
+// so "a%2Fb" is sent as "a%252Fb". Use AddEncodedParams for values that are
+// already escaped.
 func AddParams(key, value string) ParamsOption {
-	return func() string {
-		return key + "=" + value
+	return func(r *request) {
+		r.query.Add(key, value)
 	}
 }
 
-func (c *Client) AddCookie(cookie []*http.Cookie) {
-	c.cookie = cookie
+// AddParamsList adds one query parameter per value, e.g. id=1&id=2.
+func AddParamsList(key string, values ...string) ParamsOption {
+	return func(r *request) {
+		for _, value := range values {
+			r.query.Add(key, value)
+		}
+	}
 }
 
-func (c *Client) Get(url string, data any, opts ...ParamsOption) (*Result, error) {
-	url = url + "?"
-	for i := 0; i < len(opts); i++ {
-		url = url + opts[i]()
-		if i != len(opts)-1 {
-			url = url + "&"
+// AddParamsMap adds every key and value of m as query parameters, the query
+// string is sorted by key.
+func AddParamsMap(m map[string]string) ParamsOption {
+	return func(r *request) {
+		for key, value := range m {
+			r.query.Add(key, value)
 		}
 	}
-	return c.doReq(url, "GET", data)
 }
 
-func (c *Client) Post(url string, data any, opts ...ParamsOption) (*Result, error) {
-	url = url + "?"
-	for i := 0; i < len(opts); i++ {
-		url = url + opts[i]()
-		if i != len(opts)-1 {
-			url = url + "&"
+// AddEncodedParams adds a query parameter whose key and value are already
+// query-escaped, they are unescaped first so they are not escaped twice.
+// Invalid escapes are kept as they are.
+func AddEncodedParams(key, value string) ParamsOption {
+	return func(r *request) {
+		if k, err := url.QueryUnescape(key); err == nil {
+			key = k
+		}
+		if v, err := url.QueryUnescape(value); err == nil {
+			value = v
+		}
+		r.query.Add(key, value)
+	}
+}
+
+// Clone returns a copy of the client with opts applied to it. The copy has its
+// own headers, cookies, options and Stats, changing it never changes c. A
+// cookie jar is not shared either, the copy of a client with a jar starts with
+// an empty in-memory one, see WithDefaultCookieJar, WithCookieJar in opts
+// gives it another. It shares the transport, and so the connection pool, and
+// the circuit breaker of c unless opts replace them, a TLS or pool option
+// gives the copy its own transport.
+func (c *Client) Clone(opts ...ClientOption) *Client {
+	c.cookieLock().RLock()
+	clone := *c
+	c.cookieLock().RUnlock()
+	clone.cookie = append([]*http.Cookie(nil), clone.cookie...)
+	clone.cookieMu = &sync.RWMutex{}
+	clone.stats = &clientStats{}
+	clone.hostTransports = &hostTransports{}
+	clone.header = make(map[string]string, len(c.header))
+	for k, v := range c.header {
+		clone.header[k] = v
+	}
+	clone.successStatuses = append([]statusRange(nil), c.successStatuses...)
+	clone.optionErrs = append([]error(nil), c.optionErrs...)
+	clone.middlewares = append([]func(*http.Request) error(nil), c.middlewares...)
+	clone.responseMiddlewares = append([]func(*http.Response) error(nil), c.responseMiddlewares...)
+	clone.roundTripperMiddlewares = append([]func(http.RoundTripper) http.RoundTripper(nil), c.roundTripperMiddlewares...)
+	if c.http != nil {
+		httpClient := *c.http
+		clone.http = &httpClient
+		// the cookies set by responses to the copy stay in the copy
+		if httpClient.Jar != nil {
+			WithDefaultCookieJar()(&clone)
+		}
+	}
+	// the transport of c is shared, it must be cloned before it is changed
+	clone.transport = nil
+	for _, opt := range opts {
+		opt(&clone)
+	}
+	clone.buildRoundTripper()
+	return &clone
+}
+
+// CloseIdleConnections closes the idle connections of the client, those kept
+// for the TLS server names of overridden hosts included.
+func (c *Client) CloseIdleConnections() {
+	if c.http != nil {
+		c.http.CloseIdleConnections()
+	}
+	c.serverNameTransports().closeIdleConnections()
+}
+
+// AddCookie appends cookies to the cookies sent with every request, see
+// SetCookies to replace them.
+func (c *Client) AddCookie(cookies []*http.Cookie) {
+	c.cookieLock().Lock()
+	defer c.cookieLock().Unlock()
+	c.cookie = append(c.cookie[:len(c.cookie):len(c.cookie)], cookies...)
+}
+
+// SetCookies replaces the cookies sent with every request.
+func (c *Client) SetCookies(cookies []*http.Cookie) {
+	c.cookieLock().Lock()
+	defer c.cookieLock().Unlock()
+	c.cookie = append([]*http.Cookie(nil), cookies...)
+}
+
+// RemoveCookie stops sending the cookies named name.
+func (c *Client) RemoveCookie(name string) {
+	c.cookieLock().Lock()
+	defer c.cookieLock().Unlock()
+	kept := make([]*http.Cookie, 0, len(c.cookie))
+	for _, cookie := range c.cookie {
+		if cookie.Name != name {
+			kept = append(kept, cookie)
+		}
+	}
+	c.cookie = kept
+}
+
+// ClearCookies removes every cookie added to the client, the cookie jar is
+// left as is.
+func (c *Client) ClearCookies() {
+	c.cookieLock().Lock()
+	defer c.cookieLock().Unlock()
+	c.cookie = nil
+}
+
+// cookies returns the cookies sent with every request, the slice is never
+// modified.
+func (c *Client) cookies() []*http.Cookie {
+	c.cookieLock().RLock()
+	defer c.cookieLock().RUnlock()
+	return c.cookie
+}
+
+// AddCookiesFromResult adds the cookies set by a response to the client,
+// replacing client cookies of the same name.
+func (c *Client) AddCookiesFromResult(result *Result) {
+	cookies := result.Cookies()
+	c.cookieLock().Lock()
+	defer c.cookieLock().Unlock()
+	merged := make([]*http.Cookie, 0, len(c.cookie)+len(cookies))
+	for _, old := range c.cookie {
+		replaced := false
+		for _, cookie := range cookies {
+			if cookie.Name == old.Name {
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			merged = append(merged, old)
+		}
+	}
+	c.cookie = append(merged, cookies...)
+}
+
+// Do sends a request with an arbitrary HTTP method, e.g. PROPFIND or PURGE.
+func (c *Client) Do(method, url string, data any, opts ...ParamsOption) (*Result, error) {
+	if method == "" || strings.IndexFunc(method, unicode.IsSpace) >= 0 {
+		return nil, fmt.Errorf("invalid method: %q", method)
+	}
+	r := newRequest(method, url, data, opts...)
+	if r.err != nil {
+		return nil, r.err
+	}
+	if err := r.expandPath(); err != nil {
+		return nil, err
+	}
+	var err error
+	r.url, err = c.resolveURL(r.url)
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddInt64(&c.counters().requests, 1)
+	result, err := c.doReq(r)
+	c.counters().countResult(err)
+	if err != nil {
+		err = fmt.Errorf("jhttp: %s %s: %w", r.method, c.errorTarget(r.buildURL()), err)
+		c.notifyError(r, err)
+		return result, err
+	}
+	return result, nil
+}
+
+// notifyError calls the OnError hook, a panic in the hook is logged instead of
+// reaching the caller.
+func (c *Client) notifyError(r *request, err error) {
+	if c.onError == nil {
+		return
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("jhttp: recovered panic in OnError hook: %v", p)
+		}
+	}()
+	c.onError(r.context(c), r.method, c.errorURL(r.buildURL()), err)
+}
+
+// errorTarget is the host and path of rawURL for errors, the query may hold
+// secrets and is only kept with WithFullURLInErrors.
+func (c *Client) errorTarget(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "(invalid url)"
+	}
+	if c.fullURLInErrors {
+		return u.Redacted()
+	}
+	return u.Host + u.EscapedPath()
+}
+
+// errorURL is rawURL for a *url.Error, without the query unless
+// WithFullURLInErrors is set.
+func (c *Client) errorURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "(invalid url)"
+	}
+	if !c.fullURLInErrors {
+		u.RawQuery, u.ForceQuery, u.Fragment, u.RawFragment = "", false, "", ""
+	}
+	return u.Redacted()
+}
+
+func (c *Client) resolveURL(rawURL string) (string, error) {
+	if c.baseURL == "" {
+		return rawURL, nil
+	}
+	ref, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if ref.IsAbs() {
+		return rawURL, nil
+	}
+	base, err := url.Parse(c.baseURL)
+	if err != nil {
+		return "", err
+	}
+	// a scheme-relative url, "//host/path", takes the scheme of the base
+	if ref.Host != "" {
+		return base.ResolveReference(ref).String(), nil
+	}
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+		if base.RawPath != "" {
+			base.RawPath += "/"
 		}
 	}
-	return c.doReq(url, "POST", data)
+	// resolve against the base path, "./" keeps "/a:b" from being parsed as the
+	// scheme a once the slash is trimmed, "a:b" itself is an absolute url
+	ref, err = url.Parse("./" + strings.TrimLeft(rawURL, "/"))
+	if err != nil {
+		return "", err
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+func (c *Client) Get(url string, data any, opts ...ParamsOption) (*Result, error) {
+	return c.Do("GET", url, data, opts...)
+}
+
+func (c *Client) Post(url string, data any, opts ...ParamsOption) (*Result, error) {
+	return c.Do("POST", url, data, opts...)
+}
+
+// PostFile uploads a single file under fieldName as multipart form-data,
+// together with extraFields as text fields. Unlike NewFormParams, a file of
+// another extension than zip, json or xml is typed by the system MIME table,
+// then by its content, instead of as application/octet-stream.
+func (c *Client) PostFile(url string, fieldName, filePath string, extraFields map[string]string, opts ...ParamsOption) (*Result, error) {
+	keys := make([]string, 0, len(extraFields))
+	for key := range extraFields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	formOpts := make([]FormOption, 0, len(keys)+2)
+	for _, key := range keys {
+		formOpts = append(formOpts, AddFormParams(key, extraFields[key], Text))
+	}
+	formOpts = append(formOpts, AddFormParams(fieldName, filePath, File), detectContentType())
+	formData, err := NewFormParams(formOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return c.Post(url, formData, opts...)
+}
+
+func (c *Client) Put(url string, data any, opts ...ParamsOption) (*Result, error) {
+	return c.Do("PUT", url, data, opts...)
 }
 
 func (c *Client) WebSocket(url string) (*websocket.Conn, *http.Response, error) {
@@ -93,97 +691,593 @@ func (c *Client) WebSocket(url string) (*websocket.Conn, *http.Response, error)
 	for k, v := range c.header {
 		header.Set(k, v)
 	}
-	return c.websocket.Dial(url, header)
+	conn, resp, err := c.websocket.Dial(url, header)
+	if err != nil {
+		return nil, resp, wrapTransportError(err)
+	}
+	return conn, resp, nil
+}
+
+func (c *Client) Delete(url string, data any, opts ...ParamsOption) (*Result, error) {
+	return c.Do("DELETE", url, data, opts...)
 }
 
-func (c *Client) doReq(url string, reqType string, data any) (*Result, error) {
+func (c *Client) Patch(url string, data any, opts ...ParamsOption) (*Result, error) {
+	return c.Do("PATCH", url, data, opts...)
+}
+
+func (c *Client) Head(url string, opts ...ParamsOption) (*Result, error) {
+	return c.Do("HEAD", url, nil, opts...)
+}
+
+func (c *Client) Options(url string, opts ...ParamsOption) (*Result, error) {
+	return c.Do("OPTIONS", url, nil, opts...)
+}
+
+func WithContentType(data any, contentType string) ContentTypeData {
+	return ContentTypeData{ContentType: contentType, Data: data}
+}
+
+func (c *Client) doReq(r *request) (*Result, error) {
 	var (
-		result    *Result
-		err       error
-		dataBytes []byte
+		result *Result
+		err    error
 	)
-	for i := 0; i < c.retry+1; i++ {
-		switch v := data.(type) {
-		case FormData:
-			result, err = c.doForm(url, reqType, v)
-		case []byte:
-			result, err = c.doBytes(url, reqType, v)
-		case string:
-			result, err = c.doString(url, reqType, v)
-		default:
-			dataBytes, err = json.Marshal(v)
-			if err != nil {
+	reqURL := r.buildURL()
+	ctx := r.context(c)
+	if err = c.setIdempotencyKey(r); err != nil {
+		return nil, err
+	}
+	// an invalid request or body fails the same way on every attempt, it
+	// returns before the first one
+	validReq, err := http.NewRequest(r.method, reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	host := validReq.URL.Host
+	data, contentType, offset, err := c.requestBody(r)
+	if err != nil {
+		return nil, err
+	}
+	send := c.sender(r, reqURL, data, contentType)
+	retry := c.retries(r)
+	start := c.clock()
+	var attempts []Attempt
+	// refreshed is set once a 401 made the token provider refresh the token,
+	// rejected only for the attempt with the refreshed token
+	refreshed, rejected := false, false
+	for i := 0; i < retry+1; i++ {
+		attemptStart := c.clock()
+		if len(attempts) > 0 {
+			if err = rewindBody(data, offset, err); err != nil {
 				return nil, err
 			}
-			result, err = c.doBytes(url, reqType, dataBytes)
 		}
-		if err == nil && result.IsSuccess() {
+		// fetch the token first, a failure must not leave the half-open probe
+		// claimed
+		if r.bearerToken, err = c.token(ctx, rejected); err != nil {
+			return c.failResult(result, err)
+		}
+		if err = c.allowCircuit(host); err != nil {
+			return c.failResult(result, err)
+		}
+		rejected = false
+		var cancel context.CancelFunc
+		result, cancel, err = c.attempt(ctx, r, send)
+		// decide once whether a failure is retried, never for a cancelled one
+		final := err != nil && finalFailure(ctx, err)
+		retryable := err != nil && !final && c.retryable(result, err)
+		c.recordCircuit(host, final, retryable)
+		if err == nil {
+			// a streamed body keeps the attempt context until it is closed
+			if !result.attachCancel(cancel) {
+				cancel()
+			}
+			result.attempts = len(attempts) + 1
+			result.totalDuration = c.clock().Sub(start)
 			return result, nil
 		}
-		time.Sleep(time.Millisecond * 500)
+		cancel()
+		attempts = append(attempts, newAttempt(len(attempts), attemptStart, c.clock(), result, err))
+		if result != nil {
+			_ = result.Close()
+			result.attempts = len(attempts)
+			result.totalDuration = c.clock().Sub(start)
+		}
+		if final {
+			return c.failResult(result, err)
+		}
+		// send a rejected token once more with a refreshed one, it is not a
+		// retry
+		if !refreshed && c.refreshToken(attempts[len(attempts)-1]) {
+			refreshed, rejected = true, true
+			i--
+			continue
+		}
+		if i == retry {
+			break
+		}
+		if !retryable {
+			return c.failResult(result, err)
+		}
+		wait, ok := c.waitBeforeRetry(i, len(attempts), start, result, err)
+		if !ok {
+			break
+		}
+		atomic.AddInt64(&c.counters().retries, 1)
+		c.notifyRetry(r, attempts[len(attempts)-1], wait)
+		// stop waiting as soon as the request context is done
+		if err := c.sleepFor(ctx, wait); err != nil {
+			return c.failResult(result, fmt.Errorf("wait to retry: %w", wrapTransportError(err)))
+		}
+	}
+	if retry > 0 {
+		err = &RetryExhaustedError{Attempts: attempts, Elapsed: c.clock().Sub(start)}
+	}
+	return c.failResult(result, err)
+}
+
+// requestBody returns the body of r and its Content-Type, a value of another
+// type than the supported bodies is marshaled to JSON. offset is where a
+// seekable reader starts, so it can be rewound on retry.
+func (c *Client) requestBody(r *request) (any, string, int64, error) {
+	data := r.data
+	contentType := ""
+	if v, ok := data.(ContentTypeData); ok {
+		data, contentType = v.Data, v.ContentType
+	}
+	var offset int64
+	if seeker, ok := data.(io.Seeker); ok {
+		var err error
+		if offset, err = seeker.Seek(0, io.SeekCurrent); err != nil {
+			return nil, "", 0, err
+		}
+	}
+	switch data.(type) {
+	case nil, FormData, []byte, string, url.Values, io.Reader:
+	default:
+		marshal := c.jsonMarshal
+		if marshal == nil {
+			marshal = json.Marshal
+		}
+		dataBytes, err := marshal(data)
+		if err != nil {
+			return nil, "", 0, fmt.Errorf("marshal json body: %w", err)
+		}
+		// marshaled bodies are sent as JSON unless the client sets a
+		// Content-Type
+		if contentType == "" && !c.hasHeader("Content-Type") {
+			contentType = "application/json; charset=utf-8"
+		}
+		data = dataBytes
+	}
+	if _, ok := data.(io.Reader); ok && r.hedgeDelay > 0 {
+		return nil, "", 0, errors.New("cannot hedge a request with an io.Reader body")
+	}
+	return data, contentType, offset, nil
+}
+
+// rewindBody rewinds a reader body to offset before it is sent again, a
+// reader can only be sent again when it can be rewound. err is the failure of
+// the last attempt.
+func rewindBody(data any, offset int64, err error) error {
+	reader, ok := data.(io.Reader)
+	if !ok {
+		return nil
+	}
+	seeker, ok := reader.(io.Seeker)
+	if !ok {
+		return fmt.Errorf("cannot retry with a consumed io.Reader body: %w", err)
+	}
+	_, err = seeker.Seek(offset, io.SeekStart)
+	return err
+}
+
+// sender returns the func making one attempt with the body, a response
+// rejected by the success check is an error.
+func (c *Client) sender(r *request, reqURL string, data any, contentType string) func(context.Context) (*Result, error) {
+	return func(attemptCtx context.Context) (*Result, error) {
+		result, err := c.sendBody(attemptCtx, r, reqURL, data, contentType)
+		if err == nil && !c.checkSuccess(result) {
+			// never fall through with a nil error for a rejected response
+			statusErr := newStatusError(result.statusCode, result.status, result.header, result.cache, c.maxErrorBodyBytes)
+			err = c.decodeError(result, fmt.Errorf("success check rejected response: %w", statusErr))
+		}
+		return result, err
+	}
+}
+
+// sendBody sends the request with the body of its type.
+func (c *Client) sendBody(ctx context.Context, r *request, reqURL string, data any, contentType string) (*Result, error) {
+	switch v := data.(type) {
+	case FormData:
+		return c.doForm(ctx, r, reqURL, v)
+	case []byte:
+		return c.doBytes(ctx, r, reqURL, v, contentType)
+	case string:
+		return c.doString(ctx, r, reqURL, v, contentType)
+	case url.Values:
+		if contentType == "" {
+			contentType = "application/x-www-form-urlencoded"
+		}
+		return c.doString(ctx, r, reqURL, v.Encode(), contentType)
+	case io.Reader:
+		return c.doReader(ctx, r, reqURL, v, contentType)
+	}
+	// no body, do not marshal nil to `null`
+	return c.doBytes(ctx, r, reqURL, nil, contentType)
+}
+
+// attempt makes one attempt with send, hedged with WithHedging, and returns
+// the cancel func of its context.
+func (c *Client) attempt(ctx context.Context, r *request, send func(context.Context) (*Result, error)) (*Result, context.CancelFunc, error) {
+	if r.hedgeDelay > 0 {
+		return c.hedge(ctx, r, send)
+	}
+	attemptCtx, cancel := r.attemptContext(ctx)
+	result, err := send(attemptCtx)
+	return result, cancel, err
+}
+
+// finalFailure reports whether a failed attempt ends the request: a cancelled
+// or expired context, an attempt deadline is retried, or a request rejected by
+// a middleware, which was never sent.
+func finalFailure(ctx context.Context, err error) bool {
+	return ctx.Err() != nil || errors.Is(err, context.Canceled) || rejectedByMiddleware(err)
+}
+
+// failResult returns the Result of a failed request together with its error
+// when WithReturnResultOnError is set.
+func (c *Client) failResult(result *Result, err error) (*Result, error) {
+	if c.returnResultOnError && result != nil {
+		return result, err
 	}
 	return nil, err
 }
 
-func (c *Client) doBytes(url string, reqType string, data []byte) (*Result, error) {
-	req, err := http.NewRequest(reqType, url, bytes.NewBuffer(data))
+func (c *Client) doBytes(ctx context.Context, r *request, url string, data []byte, contentType string) (*Result, error) {
+	// send no body at all rather than an empty buffer
+	var body io.Reader = http.NoBody
+	if len(data) > 0 {
+		body = bytes.NewBuffer(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, r.method, url, body)
 	if err != nil {
 		return nil, err
 	}
-	return c.do(req)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return c.do(req, r)
 }
 
-func (c *Client) doString(url string, reqType string, data string) (*Result, error) {
-	req, err := http.NewRequest(reqType, url, bytes.NewBufferString(data))
+func (c *Client) doString(ctx context.Context, r *request, url string, data string, contentType string) (*Result, error) {
+	req, err := http.NewRequestWithContext(ctx, r.method, url, bytes.NewBufferString(data))
 	if err != nil {
 		return nil, err
 	}
-	return c.do(req)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return c.do(req, r)
 }
 
-func (c *Client) doForm(url string, reqType string, formData FormData) (*Result, error) {
-	req, err := http.NewRequest(reqType, url, formData.buf)
+// doReader streams the body from reader, the client never closes it.
+func (c *Client) doReader(ctx context.Context, r *request, url string, reader io.Reader, contentType string) (*Result, error) {
+	if closer, ok := reader.(io.ReadCloser); ok {
+		reader = io.NopCloser(closer)
+	}
+	req, err := http.NewRequestWithContext(ctx, r.method, url, reader)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return c.do(req, r)
+}
+
+func (c *Client) doForm(ctx context.Context, r *request, url string, formData FormData) (*Result, error) {
+	// read the buffer without draining it, every attempt sends the whole form
+	req, err := http.NewRequestWithContext(ctx, r.method, url, bytes.NewReader(formData.buf.Bytes()))
 	if err != nil {
 		return nil, err
 	}
 	// set Form Content-Type
 	req.Header.Set("Content-Type", formData.writer.FormDataContentType())
-	return c.do(req)
+	return c.do(req, r)
 }
 
-func (c *Client) do(req *http.Request) (*Result, error) {
-	var resp *http.Response
-	var err error
-	if c.http == nil {
-		c.http = http.DefaultClient
+func (c *Client) do(req *http.Request, r *request) (*Result, error) {
+	c.applyHeaders(req, r)
+	httpClient := c.httpClientFor(req, r)
+	if err := c.applyMiddlewares(req); err != nil {
+		closeRequestBody(req)
+		return nil, err
+	}
+	var t *tracer
+	if c.trace {
+		t = &tracer{}
+		req = t.withTrace(req)
+	}
+	phase := &phaseTracker{}
+	req = phase.withTrace(req)
+	// the slot is held until the body was read, a streamed body frees it on
+	// close
+	release, err := c.acquireAttempt(req.Context())
+	if err != nil {
+		closeRequestBody(req)
+		return nil, err
 	}
-	// set context
-	if c.ctx != nil {
-		req = req.WithContext(c.ctx)
+	defer func() {
+		if release != nil {
+			release()
+		}
+	}()
+	// send request
+	start := time.Now()
+	resp, err := c.roundTrip(httpClient, req, phase)
+	if err != nil {
+		return nil, err
+	}
+	if !c.rawContentEncoding {
+		if err = decompress(resp); err != nil {
+			return nil, err
+		}
 	}
-	// set http header
+	if err = c.applyResponseMiddlewares(resp); err != nil {
+		return nil, err
+	}
+	// without a success check only 2xx responses become a Result
+	if c.successCheck == nil && !c.successStatus(resp.StatusCode) {
+		return c.statusFailure(resp, r, start, t)
+	}
+	result, err := c.newResult(resp, r, start, r.stream, t)
+	if err == nil && result.stream != nil {
+		result.stream.release, release = release, nil
+	}
+	return result, err
+}
+
+// applyHeaders sets the headers, auth and cookies of the client and of r on
+// req.
+func (c *Client) applyHeaders(req *http.Request, r *request) {
+	// set http header, headers already set for the body take precedence
 	for k, v := range c.header {
+		if req.Header.Get(k) != "" {
+			continue
+		}
 		req.Header.Set(k, v)
 	}
+	// set request header, overrides the client header of the same key
+	for k, v := range r.header {
+		req.Header[k] = v
+	}
+	// an empty User-Agent is not sent at all
+	if _, ok := req.Header["User-Agent"]; !ok {
+		req.Header["User-Agent"] = []string{c.userAgent}
+	}
+	c.applyAuth(req, r)
+	// close the connection after the response, even with a later WithTransport
+	if c.disableKeepAlives {
+		req.Close = true
+	}
+	// set idempotency key, shared by all attempts
+	if r.idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", r.idempotencyKey)
+	}
 	// set http cookie
-	for _, cookie := range c.cookie {
+	for _, cookie := range c.cookies() {
 		req.AddCookie(cookie)
 	}
-	// send request
-	resp, err = c.http.Do(req)
-	if err != nil {
-		return nil, err
+	// set request cookie, for this request only
+	for _, cookie := range r.cookies {
+		req.AddCookie(cookie)
+	}
+}
+
+// applyAuth sets the Authorization header of req.
+func (c *Client) applyAuth(req *http.Request, r *request) {
+	// set client basic auth, unless the request sets its own Authorization
+	if c.basicAuth != nil && r.header.Get("Authorization") == "" {
+		req.SetBasicAuth(c.basicAuth.username, c.basicAuth.password)
+	}
+	// set the token of the token provider, unless the request sets its own
+	// Authorization
+	if r.bearerToken != "" && r.header.Get("Authorization") == "" {
+		req.Header.Set("Authorization", "Bearer "+r.bearerToken)
+	}
+	// set request basic auth, overrides the client Authorization header
+	if r.basicAuth != nil {
+		req.SetBasicAuth(r.basicAuth.username, r.basicAuth.password)
 	}
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("status code: %d", resp.StatusCode)
+}
+
+// httpClientFor returns the http.Client sending req, with the transport of
+// the round tripper middlewares and of an overridden Host.
+func (c *Client) httpClientFor(req *http.Request, r *request) *http.Client {
+	// never assign c.http here, other requests may be reading it
+	httpClient := c.http
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	// a Host header or override is sent as req.Host
+	rt := c.roundTripper
+	if host := c.hostOverrideOf(req, r); host != "" {
+		req.Host = host
+		if req.URL.Scheme == "https" && !c.noHostOverrideSNI {
+			if hostRT := c.serverNameTransport(httpClient, host); hostRT != nil {
+				rt = hostRT
+			}
+		}
 	}
-	result, err := NewResult(resp)
+	if rt == nil {
+		return httpClient
+	}
+	copied := *httpClient
+	copied.Transport = rt
+	return &copied
+}
+
+// roundTrip sends req with httpClient between the OnRequest and OnResponse
+// hooks, a failure is labelled with the phase it happened in.
+func (c *Client) roundTrip(httpClient *http.Client, req *http.Request, phase *phaseTracker) (*http.Response, error) {
+	c.notifyRequest(req)
+	start := time.Now()
+	resp, err := httpClient.Do(req)
+	c.notifyResponse(req, resp, time.Since(start))
+	if err == nil {
+		return resp, nil
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		urlErr.URL = c.errorURL(urlErr.URL)
+	}
+	// only a rejected redirect returns both a response and an error, the
+	// default policy gives up after 10 redirects
+	if resp != nil && httpClient.CheckRedirect == nil {
+		return nil, wrapSentinel(ErrTooManyRedirects, err)
+	}
+	return nil, wrapTransportError(phase.wrap(err))
+}
+
+// statusFailure returns the StatusError of a response with a failed status,
+// together with its Result for WithReturnResultOnError and WithErrorDecoder.
+func (c *Client) statusFailure(resp *http.Response, r *request, start time.Time, t *tracer) (*Result, error) {
+	// read a bounded part of the error body, a huge one is discarded
+	if !c.returnResultOnError && c.errorDecoder == nil {
+		body, truncated := readErrorBody(resp.Body, c.maxErrorBodyBytes)
+		statusErr := newStatusError(resp.StatusCode, resp.Status, resp.Header, body, c.maxErrorBodyBytes)
+		statusErr.Truncated = truncated
+		return nil, statusErr
+	}
+	result, truncated := newErrorResult(resp, c.maxErrorBodyBytes)
+	result, err := c.completeResult(result, r, start, false, t)
 	if err != nil {
 		return nil, err
 	}
+	statusErr := newStatusError(resp.StatusCode, resp.Status, resp.Header, result.cache, c.maxErrorBodyBytes)
+	statusErr.Truncated = truncated
+	return result, c.decodeError(result, statusErr)
+}
+
+// closeRequestBody closes the body of a request that is not sent.
+func closeRequestBody(req *http.Request) {
+	if req.Body != nil {
+		_ = req.Body.Close()
+	}
+}
+
+func (c *Client) newResult(resp *http.Response, r *request, start time.Time, stream bool, t *tracer) (*Result, error) {
+	var (
+		result *Result
+		err    error
+	)
+	if stream {
+		result = newStreamResult(resp)
+	} else {
+		result, err = newBufferedResult(resp, c.responseLimit(r))
+		if err != nil {
+			return nil, wrapTransportError(err)
+		}
+	}
+	return c.completeResult(result, r, start, stream, t)
+}
+
+// completeResult converts the buffered body and records the request details.
+func (c *Client) completeResult(result *Result, r *request, start time.Time, stream bool, t *tracer) (*Result, error) {
+	if !stream && c.charsetConversion {
+		if err := result.convertCharset(); err != nil {
+			return nil, err
+		}
+	}
+	result.idempotencyKey = r.idempotencyKey
+	result.unmarshal = c.jsonUnmarshal
+	result.duration = time.Since(start)
+	if t != nil {
+		result.traceInfo = t.info(time.Now(), stream)
+	}
 	return result, nil
 }
 
 func (c *Client) GetHeader(key string) string {
 	return c.header[key]
 }
+
+func (c *Client) decodeError(result *Result, err error) error {
+	if c.errorDecoder != nil {
+		if decoded := c.errorDecoder(result); decoded != nil {
+			return decoded
+		}
+	}
+	return err
+}
+
+func (c *Client) checkSuccess(result *Result) bool {
+	if c.successCheck != nil {
+		return c.successCheck(result)
+	}
+	return c.successStatus(result.statusCode)
+}
+
+// successStatus reports whether code is successful, by default 2xx and 304
+// for revalidation.
+func (c *Client) successStatus(code int) bool {
+	if len(c.successStatuses) == 0 {
+		if c.noRedirects && code >= 300 && code <= 399 {
+			return true
+		}
+		return (code >= 200 && code <= 299) || code == http.StatusNotModified
+	}
+	for _, status := range c.successStatuses {
+		if code >= status.lo && code <= status.hi {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Client) responseLimit(r *request) int64 {
+	if r.maxResponseBytes > 0 {
+		return r.maxResponseBytes
+	}
+	if c.maxResponseBytes > 0 {
+		return c.maxResponseBytes
+	}
+	return int64(MaxReadSize)
+}
+
+// setIdempotencyKey sets the key shared by all attempts of r. A key the caller
+// set, by option or header, wins over a generated one.
+func (c *Client) setIdempotencyKey(r *request) (err error) {
+	switch {
+	case r.idempotencyKey != "":
+	case r.header.Get("Idempotency-Key") != "":
+		r.idempotencyKey = r.header.Get("Idempotency-Key")
+	case c.headerValue("Idempotency-Key") != "":
+		r.idempotencyKey = c.headerValue("Idempotency-Key")
+	case c.autoIdempotencyKey:
+		r.idempotencyKey, err = newIdempotencyKey()
+	}
+	return err
+}
+
+// headerValue returns the value of the client header key, lookups are
+// case-insensitive.
+func (c *Client) headerValue(key string) string {
+	for k, v := range c.header {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
+
+func (c *Client) hasHeader(key string) bool {
+	for k := range c.header {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,21 @@
 package jhttp
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -18,6 +33,29 @@ func TestNewClient(t *testing.T) {
 	require.Equal(t, "application/vnd.github.v3+json", client.header["Accept"])
 }
 
+func TestZeroClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "s1"})
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	client := &Client{}
+	resp, err := client.Get(server.URL, nil)
+	require.Nil(t, err)
+	require.Equal(t, true, resp.Equal("ok"))
+	client.AddCookiesFromResult(resp)
+	resp, err = client.Get(server.URL, nil, WithReqHostOverride("example.com"))
+	require.Nil(t, err)
+	require.Equal(t, true, resp.Equal("ok"))
+	require.GreaterOrEqual(t, client.Stats().Requests, int64(2))
+	client.CloseIdleConnections()
+
+	resp, err = client.Clone().Get(server.URL, nil)
+	require.Nil(t, err)
+	require.Equal(t, true, resp.Equal("ok"))
+}
+
 func TestGet(t *testing.T) {
 	client := NewClient(
 		AddHeader("Accept", "application/vnd.github.v3+json"),
@@ -65,3 +103,971 @@ func TestWebsocket(t *testing.T) {
 	require.Nil(t, err)
 	require.Contains(t, string(msg), "服务端主动向你推送")
 }
+
+func TestPut(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if r.FormValue("username") != "" {
+			_, _ = w.Write([]byte("form:" + r.FormValue("username")))
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(body)
+	}))
+	defer server.Close()
+	client := NewClient()
+
+	resp, err := client.Put(server.URL, MyStruct{Key: "k1", Value: "v1"})
+	require.Nil(t, err)
+	require.Equal(t, true, resp.Equal(`{"key":"k1","value":"v1"}`))
+
+	formParams, err := NewFormParams(
+		AddFormParams("username", "username", Text),
+	)
+	require.Nil(t, err)
+	resp, err = client.Put(server.URL, formParams)
+	require.Nil(t, err)
+	require.Equal(t, true, resp.Equal("form:username"))
+}
+
+func TestDelete(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write([]byte("body:" + string(body)))
+	}))
+	defer server.Close()
+	client := NewClient()
+
+	resp, err := client.Delete(server.URL, nil)
+	require.Nil(t, err)
+	require.Equal(t, true, resp.Equal("body:"))
+
+	resp, err = client.Delete(server.URL, "id=1")
+	require.Nil(t, err)
+	require.Equal(t, true, resp.Equal("body:id=1"))
+}
+
+func TestPatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write([]byte(r.Method + " " + r.Header.Get("Content-Type") + " " + string(body)))
+	}))
+	defer server.Close()
+	client := NewClient(
+		AddHeader("Content-Type", "application/json"),
+	)
+
+	resp, err := client.Patch(server.URL, MyStruct{Key: "k1", Value: "v1"})
+	require.Nil(t, err)
+	require.Equal(t, true, resp.Equal(`PATCH application/json {"key":"k1","value":"v1"}`))
+
+	resp, err = client.Patch(server.URL, WithContentType(MyStruct{Key: "k1", Value: "v1"}, "application/merge-patch+json"))
+	require.Nil(t, err)
+	require.Equal(t, true, resp.Equal(`PATCH application/merge-patch+json {"key":"k1","value":"v1"}`))
+}
+
+func TestHead(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "1024")
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		if r.Method != "HEAD" {
+			_, _ = w.Write(make([]byte, 1024))
+		}
+	}))
+	defer server.Close()
+	client := NewClient()
+
+	resp, err := client.Head(server.URL)
+	require.Nil(t, err)
+	require.Equal(t, int64(1024), resp.ContentLength())
+	require.Equal(t, `"v1"`, resp.Header("ETag"))
+	require.Equal(t, "Mon, 02 Jan 2006 15:04:05 GMT", resp.Header("Last-Modified"))
+	_, err = resp.Body()
+	require.NotNil(t, err)
+}
+
+func TestOptions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "OPTIONS" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Allow", "GET, POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	client := NewClient(SetRetry(2))
+
+	resp, err := client.Options(server.URL)
+	require.Nil(t, err)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode())
+	require.Equal(t, true, resp.IsSuccess())
+	require.Equal(t, "GET, POST, OPTIONS", resp.Header("Allow"))
+	require.Equal(t, "GET, POST", resp.Header("Access-Control-Allow-Methods"))
+}
+
+func TestDo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Method))
+	}))
+	defer server.Close()
+	client := NewClient()
+
+	resp, err := client.Do("PROPFIND", server.URL, nil)
+	require.Nil(t, err)
+	require.Equal(t, true, resp.Equal("PROPFIND"))
+
+	for _, method := range []string{"", " GET", "PUR GE", "GET\n"} {
+		_, err = client.Do(method, server.URL, nil)
+		require.NotNil(t, err)
+		require.Contains(t, err.Error(), "invalid method")
+	}
+}
+
+func TestAddParamsEncoding(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.RawQuery))
+	}))
+	defer server.Close()
+	client := NewClient()
+
+	resp, err := client.Get(server.URL, nil, AddParams("q", "foo bar&baz=1"))
+	require.Nil(t, err)
+	require.Equal(t, true, resp.Equal("q=foo+bar%26baz%3D1"))
+
+	resp, err = client.Get(server.URL, nil, AddParams("a+b", "1+1=2"), AddParams("name", "张三"))
+	require.Nil(t, err)
+	require.Equal(t, true, resp.Equal("a%2Bb=1%2B1%3D2&name=%E5%BC%A0%E4%B8%89"))
+
+	resp, err = client.Get(server.URL, nil, AddParams("path", "a%2Fb"))
+	require.Nil(t, err)
+	require.Equal(t, true, resp.Equal("path=a%252Fb"))
+
+	resp, err = client.Get(server.URL, nil, AddEncodedParams("path", "a%2Fb"), AddEncodedParams("q", "foo+bar"))
+	require.Nil(t, err)
+	require.Equal(t, true, resp.Equal("path=a%2Fb&q=foo+bar"))
+}
+
+func TestWithBaseURL(t *testing.T) {
+	for _, base := range []string{"https://api.example.com/v2", "https://api.example.com/v2/"} {
+		client := NewClient(WithBaseURL(base))
+		for _, path := range []string{"/users/42", "users/42"} {
+			url, err := client.resolveURL(path)
+			require.Nil(t, err)
+			require.Equal(t, "https://api.example.com/v2/users/42", url)
+		}
+		url, err := client.resolveURL("https://other.example.com/users/42")
+		require.Nil(t, err)
+		require.Equal(t, "https://other.example.com/users/42", url)
+		url, err = client.resolveURL("//other.example.com/users/42")
+		require.Nil(t, err)
+		require.Equal(t, "https://other.example.com/users/42", url)
+		url, err = client.resolveURL("/users:42/posts")
+		require.Nil(t, err)
+		require.Equal(t, "https://api.example.com/v2/users:42/posts", url)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.RequestURI()))
+	}))
+	defer server.Close()
+	client := NewClient(WithBaseURL(server.URL + "/v2"))
+
+	resp, err := client.Get("/users/42", nil, AddParams("k1", "v1"))
+	require.Nil(t, err)
+	require.Equal(t, true, resp.Equal("/v2/users/42?k1=v1"))
+
+	resp, err = client.Get(server.URL+"/health", nil)
+	require.Nil(t, err)
+	require.Equal(t, true, resp.Equal("/health"))
+}
+
+func TestReaderBody(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, _ := io.Copy(io.Discard, r.Body)
+		if r.URL.Path == "/flaky" && atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte(strconv.FormatInt(n, 10)))
+	}))
+	defer server.Close()
+	client := NewClient()
+
+	size := 64 * 1024 * 1024
+	pr, pw := io.Pipe()
+	go func() {
+		chunk := make([]byte, 32*1024)
+		for written := 0; written < size; written += len(chunk) {
+			if _, err := pw.Write(chunk); err != nil {
+				return
+			}
+		}
+		_ = pw.Close()
+	}()
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	resp, err := client.Post(server.URL, pr)
+	require.Nil(t, err)
+	require.Equal(t, true, resp.Equal(strconv.Itoa(size)))
+	// the body is streamed, not buffered
+	runtime.ReadMemStats(&after)
+	require.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(16*1024*1024))
+
+	client = NewClient(SetRetry(1), WithRetryNonIdempotent())
+	resp, err = client.Post(server.URL+"/flaky", strings.NewReader("hello"))
+	require.Nil(t, err)
+	require.Equal(t, true, resp.Equal("5"))
+
+	atomic.StoreInt32(&attempts, 0)
+	_, err = client.Post(server.URL+"/flaky", io.MultiReader(strings.NewReader("hello")))
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "cannot retry")
+}
+
+func TestURLValuesBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(r.Header.Get("Content-Type") + " " + r.PostForm.Get("name") + " " + r.PostForm.Get("q")))
+	}))
+	defer server.Close()
+	client := NewClient()
+
+	resp, err := client.Post(server.URL, url.Values{"name": {"张三"}, "q": {"a&b=c"}})
+	require.Nil(t, err)
+	require.Equal(t, true, resp.Equal("application/x-www-form-urlencoded 张三 a&b=c"))
+}
+
+func TestPostFile(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		file, header, err := r.FormFile("upload")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		content, _ := io.ReadAll(file)
+		_, _ = w.Write([]byte(strings.Join([]string{
+			r.FormValue("name"), r.FormValue("kind"), header.Filename, header.Header.Get("Content-Type"), string(content),
+		}, "|")))
+	}))
+	defer server.Close()
+	client := NewClient()
+
+	path := filepath.Join(t.TempDir(), "report.txt")
+	require.Nil(t, os.WriteFile(path, []byte("hello world"), 0o600))
+	resp, err := client.PostFile(server.URL, "upload", path, map[string]string{"name": "report", "kind": "daily"})
+	require.Nil(t, err)
+	require.Equal(t, true, resp.Equal("report|daily|report.txt|text/plain; charset=utf-8|hello world"))
+
+	_, err = client.PostFile(server.URL, "upload", filepath.Join(t.TempDir(), "missing.txt"), nil)
+	require.NotNil(t, err)
+	require.Equal(t, true, errors.Is(err, os.ErrNotExist))
+}
+
+func TestNoBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write([]byte(fmt.Sprintf("%d %d %d", r.ContentLength, len(r.TransferEncoding), len(body))))
+	}))
+	defer server.Close()
+	client := NewClient()
+
+	resp, err := client.Get(server.URL, nil)
+	require.Nil(t, err)
+	require.Equal(t, true, resp.Equal("0 0 0"))
+
+	resp, err = client.Post(server.URL, nil)
+	require.Nil(t, err)
+	require.Equal(t, true, resp.Equal("0 0 0"))
+
+	resp, err = client.Post(server.URL, []byte{})
+	require.Nil(t, err)
+	require.Equal(t, true, resp.Equal("0 0 0"))
+}
+
+func TestJsonContentType(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Header.Get("Content-Type")))
+	}))
+	defer server.Close()
+
+	client := NewClient()
+	resp, err := client.Post(server.URL, MyStruct{Key: "k1", Value: "v1"})
+	require.Nil(t, err)
+	require.Equal(t, true, resp.Equal("application/json; charset=utf-8"))
+
+	resp, err = client.Post(server.URL, "k1=v1")
+	require.Nil(t, err)
+	require.Equal(t, false, resp.Contains("json"))
+
+	client = NewClient(AddHeader("content-type", "application/vnd.api+json"))
+	resp, err = client.Post(server.URL, MyStruct{Key: "k1", Value: "v1"})
+	require.Nil(t, err)
+	require.Equal(t, true, resp.Equal("application/vnd.api+json"))
+
+	resp, err = client.Post(server.URL, MyStruct{Key: "k1", Value: "v1"}, WithReqHeader("Content-Type", "application/hal+json"))
+	require.Nil(t, err)
+	require.Equal(t, true, resp.Equal("application/hal+json"))
+}
+
+func TestResultStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code, _ := strconv.Atoi(r.URL.Query().Get("code"))
+		w.WriteHeader(code)
+	}))
+	defer server.Close()
+	client := NewClient()
+
+	for _, code := range []int{http.StatusOK, http.StatusAccepted, http.StatusPartialContent} {
+		resp, err := client.Get(server.URL, nil, AddParams("code", strconv.Itoa(code)))
+		require.Nil(t, err)
+		require.Equal(t, code, resp.StatusCode())
+		require.Equal(t, fmt.Sprintf("%d %s", code, http.StatusText(code)), resp.Status())
+	}
+}
+
+func TestResultHeader(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "42")
+		w.Header().Set("Retry-After", "120")
+		w.Header().Add("X-Cursor", "a")
+		w.Header().Add("X-Cursor", "b")
+	}))
+	defer server.Close()
+	client := NewClient()
+
+	resp, err := client.Get(server.URL, nil)
+	require.Nil(t, err)
+	require.Equal(t, "42", resp.Header("x-ratelimit-remaining"))
+	require.Equal(t, "120", resp.Header("Retry-After"))
+	require.Equal(t, "a", resp.Header("X-Cursor"))
+	require.Equal(t, []string{"a", "b"}, resp.HeaderValues("x-cursor"))
+	require.Equal(t, []string{"a", "b"}, resp.Headers()["X-Cursor"])
+	require.Equal(t, "", resp.Header("X-Missing"))
+}
+
+func TestAddCookiesFromResult(t *testing.T) {
+	expires := time.Date(2030, 1, 2, 15, 4, 5, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "s1", Path: "/", HttpOnly: true, Expires: expires})
+			http.SetCookie(w, &http.Cookie{Name: "theme", Value: "dark", Path: "/app"})
+			return
+		}
+		session, err := r.Cookie("session")
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(session.Value))
+	}))
+	defer server.Close()
+	client := NewClient()
+	client.AddCookie([]*http.Cookie{{Name: "session", Value: "old"}, {Name: "lang", Value: "en"}})
+
+	resp, err := client.Post(server.URL+"/login", nil)
+	require.Nil(t, err)
+	cookies := resp.Cookies()
+	require.Len(t, cookies, 2)
+	require.Equal(t, "session", cookies[0].Name)
+	require.Equal(t, "/", cookies[0].Path)
+	require.Equal(t, true, cookies[0].HttpOnly)
+	require.Equal(t, expires, cookies[0].Expires)
+	require.Equal(t, "/app", cookies[1].Path)
+
+	client.AddCookiesFromResult(resp)
+	resp, err = client.Get(server.URL+"/me", nil)
+	require.Nil(t, err)
+	require.Equal(t, true, resp.Equal("s1"))
+	require.Len(t, client.cookie, 3)
+}
+
+func TestWithMaxResponseBytes(t *testing.T) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		size, _ := strconv.Atoi(r.URL.Query().Get("size"))
+		// no Content-Length, like a chunked body of unknown size
+		w.Header().Set("Transfer-Encoding", "chunked")
+		_, _ = w.Write(make([]byte, size))
+	}))
+	defer server.Close()
+	client := NewClient(WithMaxResponseBytes(1024))
+
+	resp, err := client.Get(server.URL, nil, AddParams("size", "1023"))
+	require.Nil(t, err)
+	require.Len(t, resp.Bytes(), 1023)
+
+	resp, err = client.Get(server.URL, nil, AddParams("size", "1024"))
+	require.Nil(t, err)
+	require.Len(t, resp.Bytes(), 1024)
+
+	_, err = client.Get(server.URL, nil, AddParams("size", "1025"))
+	require.Equal(t, true, errors.Is(err, ErrResponseTooLarge))
+
+	resp, err = client.Get(server.URL, nil, AddParams("size", "2048"), WithReqMaxResponseBytes(4096))
+	require.Nil(t, err)
+	require.Len(t, resp.Bytes(), 2048)
+
+	// an oversized body is not retried, it would be too large again
+	atomic.StoreInt32(&count, 0)
+	client = NewClient(WithMaxResponseBytes(1024), SetRetry(3))
+	recordSleeps(client)
+	_, err = client.Get(server.URL, nil, AddParams("size", "1025"))
+	require.Equal(t, true, errors.Is(err, ErrResponseTooLarge))
+	require.Equal(t, int32(1), atomic.LoadInt32(&count))
+}
+
+func TestResultDuration(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		if r.URL.Path == "/flaky" && atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	client := NewClient(SetRetry(1))
+
+	resp, err := client.Get(server.URL, nil)
+	require.Nil(t, err)
+	require.GreaterOrEqual(t, resp.Duration(), 50*time.Millisecond)
+	require.GreaterOrEqual(t, resp.TotalDuration(), resp.Duration())
+	require.Equal(t, 1, resp.Attempts())
+
+	resp, err = client.Get(server.URL+"/flaky", nil)
+	require.Nil(t, err)
+	require.Equal(t, 2, resp.Attempts())
+	require.GreaterOrEqual(t, resp.Duration(), 50*time.Millisecond)
+	require.GreaterOrEqual(t, resp.TotalDuration(), 100*time.Millisecond)
+	require.Greater(t, resp.TotalDuration(), resp.Duration())
+}
+
+func TestResultMethodURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new?"+r.URL.RawQuery, http.StatusFound)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	client := NewClient(WithBaseURL(server.URL))
+
+	resp, err := client.Put("/items/{id}", nil, WithPathParam("id", "42"), AddParams("k1", "v1"))
+	require.Nil(t, err)
+	require.Equal(t, "PUT", resp.Method())
+	require.Equal(t, server.URL+"/items/42?k1=v1", resp.URL())
+
+	resp, err = client.Get("/old", nil, AddParams("k1", "v1"))
+	require.Nil(t, err)
+	require.Equal(t, "GET", resp.Method())
+	require.Equal(t, server.URL+"/new?k1=v1", resp.URL())
+}
+
+func TestSuccessStatuses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/"))
+		w.WriteHeader(code)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		client  *Client
+		success map[int]bool
+	}{
+		{
+			name:    "default",
+			client:  NewClient(),
+			success: map[int]bool{200: true, 201: true, 204: true, 206: true, 299: true, 301: false},
+		},
+		{
+			name:    "statuses",
+			client:  NewClient(WithSuccessStatuses(200, 204)),
+			success: map[int]bool{200: true, 201: false, 204: true, 206: false, 299: false, 301: false},
+		},
+		{
+			name:    "range",
+			client:  NewClient(WithSuccessRange(200, 399)),
+			success: map[int]bool{200: true, 201: true, 204: true, 206: true, 299: true, 301: true},
+		},
+		{
+			name:    "statuses and range",
+			client:  NewClient(WithSuccessRange(200, 201), WithSuccessStatuses(301)),
+			success: map[int]bool{200: true, 201: true, 204: false, 206: false, 299: false, 301: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for code, success := range tt.success {
+				resp, err := tt.client.Get(fmt.Sprintf("%s/%d", server.URL, code), nil)
+				if success {
+					require.Nil(t, err, code)
+					require.Equal(t, code, resp.StatusCode())
+					continue
+				}
+				var se *StatusError
+				require.Equal(t, true, errors.As(err, &se), code)
+				require.Equal(t, code, se.Code)
+			}
+		})
+	}
+}
+
+func TestWithSuccessCheck(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		switch r.URL.Path {
+		case "/error":
+			_, _ = w.Write([]byte(`{"code":5000}`))
+		case "/accepted":
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = w.Write([]byte(`{"code":0}`))
+		default:
+			w.WriteHeader(http.StatusNotModified)
+		}
+	}))
+	defer server.Close()
+	client := NewClient(
+		SetRetry(1),
+		WithSuccessCheck(func(result *Result) bool {
+			if result.StatusCode() == http.StatusNotModified {
+				return true
+			}
+			code, err := result.GetInt("code")
+			return err == nil && code == 0
+		}),
+	)
+
+	_, err := client.Get(server.URL+"/error", nil)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "success check rejected response")
+	require.Equal(t, int32(2), atomic.LoadInt32(&attempts))
+
+	atomic.StoreInt32(&attempts, 0)
+	resp, err := client.Get(server.URL+"/accepted", nil)
+	require.Nil(t, err)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode())
+	require.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+
+	resp, err = client.Get(server.URL+"/cached", nil)
+	require.Nil(t, err)
+	require.Equal(t, http.StatusNotModified, resp.StatusCode())
+}
+
+func TestFailedResponseReturnsError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/rejected" {
+			_, _ = w.Write([]byte(`{"code":5000}`))
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(`{"code":5000}`))
+	}))
+	defer server.Close()
+
+	clients := map[string]*Client{
+		"status":        NewClient(SetRetry(1)),
+		"success check": NewClient(SetRetry(1), WithSuccessCheck(func(result *Result) bool { return false })),
+	}
+	for name, client := range clients {
+		for _, path := range []string{"/rejected", "/failed"} {
+			resp, err := client.Get(server.URL+path, nil)
+			if name == "status" && path == "/rejected" {
+				require.Nil(t, err)
+				continue
+			}
+			require.Nil(t, resp, name+path)
+			require.NotNil(t, err, name+path)
+			require.Equal(t, true, errors.Is(err, ErrRetryExhausted), name+path)
+			var se *StatusError
+			require.Equal(t, true, errors.As(err, &se), name+path)
+			require.Equal(t, `{"code":5000}`, string(se.Body))
+		}
+	}
+}
+
+func TestWithReturnResultOnError(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.Header().Set("X-Error-Code", "invalid_name")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_, _ = w.Write([]byte(`{"message":"name is required"}`))
+	}))
+	defer server.Close()
+
+	resp, err := NewClient().Get(server.URL, nil)
+	require.NotNil(t, err)
+	require.Nil(t, resp)
+
+	atomic.StoreInt32(&attempts, 0)
+	// a 422 is only retried with a retry condition
+	client := NewClient(SetRetry(1), WithReturnResultOnError(), WithRetryNonIdempotent(), WithRetryCondition(func(*Result, error) bool {
+		return true
+	}))
+	resp, err = client.Post(server.URL, MyStruct{Key: "k1"})
+	require.NotNil(t, err)
+	require.NotNil(t, resp)
+	require.Equal(t, int32(2), atomic.LoadInt32(&attempts))
+	require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode())
+	require.Equal(t, "invalid_name", resp.Header("X-Error-Code"))
+	require.Equal(t, true, resp.Equal(`{"message":"name is required"}`))
+	require.Equal(t, 2, resp.Attempts())
+}
+
+func TestResultTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	client := NewClient()
+	client.http = server.Client()
+
+	resp, err := client.Get(server.URL, nil)
+	require.Nil(t, err)
+	state := resp.TLS()
+	require.NotNil(t, state)
+	require.GreaterOrEqual(t, state.Version, uint16(tls.VersionTLS12))
+	require.NotZero(t, state.CipherSuite)
+	require.NotEmpty(t, state.PeerCertificates)
+	leaf := state.PeerCertificates[0]
+	require.Equal(t, server.Certificate().Subject.CommonName, leaf.Subject.CommonName)
+	require.Equal(t, []string{"Acme Co"}, leaf.Subject.Organization)
+
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer plain.Close()
+	resp, err = NewClient().Get(plain.URL, nil)
+	require.Nil(t, err)
+	require.Nil(t, resp.TLS())
+}
+
+type APIError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("api error %d %s: %s", e.Status, e.Code, e.Message)
+}
+
+func TestWithErrorDecoder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ok" {
+			_, _ = w.Write([]byte(`{}`))
+			return
+		}
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_, _ = w.Write([]byte(`{"error":{"code":"invalid_name","message":"name is required"}}`))
+	}))
+	defer server.Close()
+	client := NewClient(WithErrorDecoder(func(result *Result) error {
+		var envelope struct {
+			Error *APIError `json:"error"`
+		}
+		if err := result.ErrorJSON(&envelope); err != nil || envelope.Error == nil {
+			return nil
+		}
+		envelope.Error.Status = result.StatusCode()
+		return envelope.Error
+	}))
+
+	resp, err := client.Post(server.URL, MyStruct{Key: "k1"})
+	require.Nil(t, resp)
+	var apiErr *APIError
+	require.Equal(t, true, errors.As(err, &apiErr))
+	require.Equal(t, http.StatusUnprocessableEntity, apiErr.Status)
+	require.Equal(t, "invalid_name", apiErr.Code)
+	require.Equal(t, "name is required", apiErr.Message)
+
+	resp, err = client.Get(server.URL+"/ok", nil)
+	require.Nil(t, err)
+	require.NotNil(t, resp.ErrorJSON(&apiErr))
+}
+
+func TestWithOnError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+	type ctxKey struct{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "value")
+
+	var calls int32
+	var gotMethod, gotURL string
+	var gotErr error
+	client := NewClient(SetRetry(1), WithContext(ctx), WithOnError(func(ctx context.Context, method, url string, err error) {
+		atomic.AddInt32(&calls, 1)
+		require.Equal(t, "value", ctx.Value(ctxKey{}))
+		gotMethod, gotURL, gotErr = method, url, err
+	}))
+
+	_, err := client.Get(server.URL+"/ok", nil)
+	require.Nil(t, err)
+	require.Equal(t, int32(0), atomic.LoadInt32(&calls))
+
+	_, err = client.Post(server.URL+"/fail?token=secret", nil)
+	require.NotNil(t, err)
+	require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	require.Equal(t, "POST", gotMethod)
+	require.Equal(t, server.URL+"/fail", gotURL)
+	require.Equal(t, err, gotErr)
+
+	// a panicking hook does not swallow the error or crash the caller
+	client = NewClient(WithOnError(func(ctx context.Context, method, url string, err error) {
+		panic("hook failed")
+	}))
+	_, err = client.Get(server.URL+"/fail", nil)
+	var se *StatusError
+	require.Equal(t, true, errors.As(err, &se))
+}
+
+func TestSetTimeoutIsolated(t *testing.T) {
+	defaultTimeout := http.DefaultClient.Timeout
+	client1 := NewClient(SetTimeout(5 * time.Second))
+	client2 := NewClient(SetTimeout(time.Second))
+	client3 := NewClient()
+	require.Equal(t, defaultTimeout, http.DefaultClient.Timeout)
+	require.Equal(t, 5*time.Second, client1.http.Timeout)
+	require.Equal(t, time.Second, client2.http.Timeout)
+	require.Equal(t, time.Duration(0), client3.http.Timeout)
+	require.NotSame(t, http.DefaultClient, client3.http)
+}
+
+type countingTransport struct {
+	calls int32
+}
+
+func (rt *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&rt.calls, 1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestWithTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Method))
+	}))
+	defer server.Close()
+
+	rt := &countingTransport{}
+	client := NewClient(WithTransport(rt), SetTimeout(time.Second))
+	resp, err := client.Get(server.URL, nil)
+	require.Nil(t, err)
+	require.Equal(t, "GET", resp.String())
+	resp, err = client.Post(server.URL, "body")
+	require.Nil(t, err)
+	require.Equal(t, "POST", resp.String())
+	require.Equal(t, int32(2), atomic.LoadInt32(&rt.calls))
+	require.Equal(t, time.Second, client.http.Timeout)
+	require.Nil(t, http.DefaultClient.Transport)
+
+	require.NotNil(t, NewClient(WithTransport(nil)).Validate())
+}
+
+func TestCookieMethods(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var cookies []string
+		for _, cookie := range r.Cookies() {
+			cookies = append(cookies, cookie.Name+"="+cookie.Value)
+		}
+		_, _ = w.Write([]byte(strings.Join(cookies, ";")))
+	}))
+	defer server.Close()
+	client := NewClient()
+	send := func() string {
+		resp, err := client.Get(server.URL, nil)
+		require.Nil(t, err)
+		return resp.String()
+	}
+
+	client.AddCookie([]*http.Cookie{{Name: "a", Value: "1"}})
+	client.AddCookie([]*http.Cookie{{Name: "b", Value: "2"}, {Name: "c", Value: "3"}})
+	require.Equal(t, "a=1;b=2;c=3", send())
+	client.RemoveCookie("b")
+	require.Equal(t, "a=1;c=3", send())
+	client.SetCookies([]*http.Cookie{{Name: "d", Value: "4"}})
+	require.Equal(t, "d=4", send())
+	client.ClearCookies()
+	require.Equal(t, "", send())
+
+	// cookies may change while requests are in flight
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			client.AddCookie([]*http.Cookie{{Name: "n" + strconv.Itoa(i), Value: "v"}})
+			client.RemoveCookie("n" + strconv.Itoa(i-1))
+		}(i)
+		go func() {
+			defer wg.Done()
+			_, err := client.Get(server.URL, nil)
+			require.Nil(t, err)
+		}()
+	}
+	wg.Wait()
+	client.ClearCookies()
+	require.Equal(t, "", send())
+}
+
+func TestUserAgent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ua, ok := r.Header["User-Agent"]
+		_, _ = w.Write([]byte(fmt.Sprintf("%v %q", ok, ua)))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		client *Client
+		opts   []ParamsOption
+		want   string
+	}{
+		{name: "default", client: NewClient(), want: `true ["jhttp/` + Version + `"]`},
+		{name: "custom", client: NewClient(WithUserAgent("myapp/1.2.3 (+contact)")), want: `true ["myapp/1.2.3 (+contact)"]`},
+		{name: "empty", client: NewClient(WithUserAgent("")), want: `false []`},
+		{name: "client header", client: NewClient(AddHeader("User-Agent", "header/1")), want: `true ["header/1"]`},
+		{name: "request", client: NewClient(WithUserAgent("myapp/1")), opts: []ParamsOption{WithReqHeader("User-Agent", "once/1")}, want: `true ["once/1"]`},
+		{name: "empty request", client: NewClient(), opts: []ParamsOption{WithReqHeader("User-Agent", "")}, want: `false []`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := tt.client.Get(server.URL, nil, tt.opts...)
+			require.Nil(t, err)
+			require.Equal(t, tt.want, resp.String())
+		})
+	}
+}
+
+func TestClientConcurrent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "seen", Value: r.Header.Get("X-Client")})
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	client := NewClient(AddHeader("X-Client", "1"), WithTrace(), SetRetry(1))
+	client.http = nil
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			resp, err := client.Get(server.URL, nil)
+			require.Nil(t, err)
+			client.AddCookiesFromResult(resp)
+			require.Equal(t, "1", client.GetHeader("X-Client"))
+			_ = client.Stats()
+		}()
+		go func(i int) {
+			defer wg.Done()
+			client.AddCookie([]*http.Cookie{{Name: "n", Value: strconv.Itoa(i)}})
+			client.RemoveCookie("seen")
+			if i%5 == 0 {
+				client.ClearCookies()
+			}
+		}(i)
+	}
+	wg.Wait()
+	require.Nil(t, client.http)
+	require.Equal(t, int64(20), client.Stats().Successes)
+}
+
+func TestClone(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var cookies []string
+		for _, cookie := range r.Cookies() {
+			cookies = append(cookies, cookie.Name+"="+cookie.Value)
+		}
+		_, _ = w.Write([]byte(r.URL.Path + " " + r.Header.Get("X-Common") + " " + r.Header.Get("X-Tenant") + " " + strings.Join(cookies, ";")))
+	}))
+	defer server.Close()
+
+	parent := NewClient(AddHeader("X-Common", "c"), WithBaseURL(server.URL+"/base/"), WithMaxIdleConnsPerHost(10), WithTrace())
+	parent.AddCookie([]*http.Cookie{{Name: "p", Value: "1"}})
+	clone := parent.Clone(AddHeader("X-Tenant", "t1"), WithBaseURL(server.URL+"/tenant/"), SetTimeout(time.Second))
+	clone.AddCookie([]*http.Cookie{{Name: "t", Value: "2"}})
+
+	resp, err := parent.Get("x", nil)
+	require.Nil(t, err)
+	require.Equal(t, "/base/x c  p=1", resp.String())
+	resp, err = clone.Get("x", nil)
+	require.Nil(t, err)
+	require.Equal(t, "/tenant/x c t1 p=1;t=2", resp.String())
+	// the connection pool is shared
+	require.Equal(t, true, resp.Trace().ConnReused)
+	require.Same(t, parent.http.Transport, clone.http.Transport)
+
+	require.Equal(t, "", parent.GetHeader("X-Tenant"))
+	require.Equal(t, time.Duration(0), parent.http.Timeout)
+	require.Equal(t, int64(1), parent.Stats().Requests)
+	require.Equal(t, int64(1), clone.Stats().Requests)
+
+	// a transport option on the clone never changes the parent
+	clone = parent.Clone(WithDisableKeepAlives())
+	require.NotSame(t, parent.http.Transport, clone.http.Transport)
+	require.Equal(t, false, parent.http.Transport.(*http.Transport).DisableKeepAlives)
+}
+
+func TestCloneCookieJar(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: r.URL.Query().Get("user"), Path: "/"})
+		}
+		cookie, err := r.Cookie("session")
+		if err != nil {
+			return
+		}
+		_, _ = w.Write([]byte(cookie.Value))
+	}))
+	defer server.Close()
+
+	parent := NewClient(WithDefaultCookieJar())
+	_, err := parent.Get(server.URL+"/login", nil, AddParams("user", "parent"))
+	require.Nil(t, err)
+	clone := parent.Clone()
+	sibling := parent.Clone()
+	require.NotSame(t, parent.http.Jar, clone.http.Jar)
+	_, err = clone.Get(server.URL+"/login", nil, AddParams("user", "clone"))
+	require.Nil(t, err)
+
+	// the login of the clone is neither sent by the parent nor by a sibling
+	resp, err := parent.Get(server.URL, nil)
+	require.Nil(t, err)
+	require.Equal(t, "parent", resp.String())
+	resp, err = sibling.Get(server.URL, nil)
+	require.Nil(t, err)
+	require.Equal(t, "", resp.String())
+	resp, err = clone.Get(server.URL, nil)
+	require.Nil(t, err)
+	require.Equal(t, "clone", resp.String())
+
+	// a jar given to the clone is used as is
+	jar := parent.http.Jar
+	shared := parent.Clone(WithCookieJar(jar))
+	resp, err = shared.Get(server.URL, nil)
+	require.Nil(t, err)
+	require.Equal(t, "parent", resp.String())
+}
@@ -0,0 +1,87 @@
+package jhttp
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// compress.go is used to decompress response bodies that net/http leaves
+// compressed, which happens when Accept-Encoding is set explicitly
+
+// WithRawContentEncoding keeps gzip and deflate response bodies compressed.
+func WithRawContentEncoding() ClientOption {
+	return func(client *Client) {
+		client.rawContentEncoding = true
+	}
+}
+
+// decompressBody reports decompression errors, e.g. truncated streams,
+// instead of returning partial data silently.
+type decompressBody struct {
+	reader   io.Reader
+	body     io.ReadCloser
+	encoding string
+}
+
+func (body *decompressBody) Read(p []byte) (int, error) {
+	n, err := body.reader.Read(p)
+	if err != nil && err != io.EOF {
+		err = fmt.Errorf("decompress %s body: %w", body.encoding, err)
+	}
+	return n, err
+}
+
+func (body *decompressBody) Close() error {
+	return body.body.Close()
+}
+
+// decompress replaces a gzip or deflate encoded response body with its
+// decompressed content.
+func decompress(resp *http.Response) error {
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	var reader io.Reader
+	switch encoding {
+	case "gzip", "x-gzip":
+		gzipReader, err := gzip.NewReader(resp.Body)
+		if err == io.EOF {
+			// empty body, e.g. a HEAD response
+			return nil
+		}
+		if err != nil {
+			_ = resp.Body.Close()
+			return fmt.Errorf("decompress %s body: %w", encoding, err)
+		}
+		reader = gzipReader
+	case "deflate":
+		// deflate should be zlib wrapped, but raw deflate is common as well
+		buffered := bufio.NewReader(resp.Body)
+		header, err := buffered.Peek(2)
+		if err == io.EOF {
+			return nil
+		}
+		if len(header) == 2 && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+			zlibReader, err := zlib.NewReader(buffered)
+			if err != nil {
+				_ = resp.Body.Close()
+				return fmt.Errorf("decompress %s body: %w", encoding, err)
+			}
+			reader = zlibReader
+		} else {
+			reader = flate.NewReader(buffered)
+		}
+	default:
+		return nil
+	}
+	resp.Body = &decompressBody{reader: reader, body: resp.Body, encoding: encoding}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return nil
+}
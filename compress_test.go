@@ -0,0 +1,74 @@
+package jhttp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecompress(t *testing.T) {
+	var gzipped bytes.Buffer
+	gzipWriter := gzip.NewWriter(&gzipped)
+	_, _ = gzipWriter.Write([]byte("hello gzip"))
+	_ = gzipWriter.Close()
+	var deflated bytes.Buffer
+	zlibWriter := zlib.NewWriter(&deflated)
+	_, _ = zlibWriter.Write([]byte("hello deflate"))
+	_ = zlibWriter.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/gzip":
+			w.Header().Set("Content-Encoding", "gzip")
+			_, _ = w.Write(gzipped.Bytes())
+		case "/truncated":
+			w.Header().Set("Content-Encoding", "gzip")
+			_, _ = w.Write(gzipped.Bytes()[:gzipped.Len()-8])
+		case "/deflate":
+			w.Header().Set("Content-Encoding", "deflate")
+			_, _ = w.Write(deflated.Bytes())
+		}
+	}))
+	defer server.Close()
+
+	// the transport negotiates gzip and decompresses it itself
+	client := NewClient()
+	resp, err := client.Get(server.URL+"/gzip", nil)
+	require.Nil(t, err)
+	require.Equal(t, "hello gzip", resp.String())
+
+	client = NewClient(AddHeader("Accept-Encoding", "gzip, deflate"))
+	resp, err = client.Get(server.URL+"/gzip", nil)
+	require.Nil(t, err)
+	require.Equal(t, "hello gzip", resp.String())
+	require.Equal(t, "", resp.Header("Content-Encoding"))
+
+	resp, err = client.Get(server.URL+"/deflate", nil)
+	require.Nil(t, err)
+	require.Equal(t, "hello deflate", resp.String())
+
+	resp, err = client.Get(server.URL+"/gzip", nil, WithStreamBody())
+	require.Nil(t, err)
+	data, err := io.ReadAll(resp.Reader())
+	require.Nil(t, err)
+	require.Equal(t, "hello gzip", string(data))
+	require.Nil(t, resp.Close())
+
+	_, err = client.Get(server.URL+"/truncated", nil)
+	require.NotNil(t, err)
+	require.Equal(t, true, errors.Is(err, io.ErrUnexpectedEOF))
+	require.Contains(t, err.Error(), "decompress gzip body")
+
+	client = NewClient(AddHeader("Accept-Encoding", "gzip"), WithRawContentEncoding())
+	resp, err = client.Get(server.URL+"/gzip", nil)
+	require.Nil(t, err)
+	require.Equal(t, gzipped.Bytes(), resp.Bytes())
+	require.Equal(t, "gzip", resp.Header("Content-Encoding"))
+}
@@ -0,0 +1,65 @@
+package jhttp
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// concurrency.go is used to limit the requests a client has in flight
+
+// WithMaxConcurrency limits the attempts in flight to n, an attempt holds its
+// slot until its body was read, or until the body is closed in streaming mode.
+// Other attempts wait for a free slot until their context ends. See
+// ClientStats for how often and how long attempts waited. A Clone shares the
+// limit unless it sets its own.
+func WithMaxConcurrency(n int) ClientOption {
+	return func(client *Client) {
+		if n < 1 {
+			client.invalidOption("WithMaxConcurrency", "invalid limit %d", n)
+			return
+		}
+		client.slots = make(chan struct{}, n)
+	}
+}
+
+// acquireSlot waits for a slot of WithMaxConcurrency, the returned func frees
+// it and may be called more than once.
+func (c *Client) acquireSlot(ctx context.Context) (func(), error) {
+	if c.slots == nil {
+		return func() {}, nil
+	}
+	select {
+	case c.slots <- struct{}{}:
+	default:
+		start := c.clock()
+		select {
+		case c.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("wait for concurrency slot: %w", wrapTransportError(ctx.Err()))
+		}
+		atomic.AddInt64(&c.counters().concurrencyWaits, 1)
+		atomic.AddInt64(&c.counters().concurrencyWaitTime, int64(c.clock().Sub(start)))
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			<-c.slots
+		})
+	}, nil
+}
+
+// acquireAttempt waits for a slot of WithMaxConcurrency and then for a token
+// of WithRateLimit, the returned func frees the slot.
+func (c *Client) acquireAttempt(ctx context.Context) (func(), error) {
+	release, err := c.acquireSlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err = c.waitRateLimit(ctx); err != nil {
+		release()
+		return nil, err
+	}
+	return release, nil
+}
@@ -0,0 +1,107 @@
+package jhttp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxConcurrency(t *testing.T) {
+	var active, peak int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&active, 1)
+		defer atomic.AddInt32(&active, -1)
+		for {
+			old := atomic.LoadInt32(&peak)
+			if n <= old || atomic.CompareAndSwapInt32(&peak, old, n) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	const n = 3
+	client := NewClient(WithMaxConcurrency(n))
+	var wg sync.WaitGroup
+	var failures int32
+	for i := 0; i < n+5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if resp, err := client.Get(server.URL, nil); err != nil || resp.String() != "ok" {
+				atomic.AddInt32(&failures, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int32(0), failures)
+	require.Equal(t, int32(n), atomic.LoadInt32(&peak))
+	stats := client.Stats()
+	require.GreaterOrEqual(t, stats.ConcurrencyWaits, int64(5))
+	require.Greater(t, stats.ConcurrencyWaitTime, time.Duration(0))
+	require.Equal(t, int64(0), stats.InFlight)
+
+	err := NewClient(WithMaxConcurrency(0)).Validate()
+	require.ErrorContains(t, err, "WithMaxConcurrency: invalid limit 0")
+}
+
+func TestMaxConcurrencyRelease(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	client := NewClient(WithMaxConcurrency(1))
+
+	// failures free their slot
+	for i := 0; i < 3; i++ {
+		_, err := client.Get(server.URL+"/fail", nil)
+		require.NotNil(t, err)
+	}
+	// a streamed body holds its slot until it is closed
+	resp, err := client.Get(server.URL, nil, WithStreamBody())
+	require.Nil(t, err)
+	require.Equal(t, int64(1), client.Stats().InFlight)
+	_, err = client.Get(server.URL, nil, WithRequestTimeout(50*time.Millisecond))
+	require.Equal(t, true, errors.Is(err, ErrTimeout))
+	require.Contains(t, err.Error(), "wait for concurrency slot")
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_, err = client.Get(server.URL, nil, WithRequestContext(ctx))
+	require.Equal(t, true, errors.Is(err, context.Canceled))
+
+	body, err := io.ReadAll(resp.Reader())
+	require.Nil(t, err)
+	require.Equal(t, "ok", string(body))
+	require.Nil(t, resp.Close())
+	require.Nil(t, resp.Close())
+	require.Equal(t, int64(0), client.Stats().InFlight)
+	_, err = client.Get(server.URL, nil)
+	require.Nil(t, err)
+
+	// a panic in the transport frees the slot too
+	panicking := NewClient(WithMaxConcurrency(1), WithTransport(panicTransport{}))
+	require.Panics(t, func() {
+		_, _ = panicking.Get(server.URL, nil)
+	})
+	require.Equal(t, int64(0), panicking.Stats().InFlight)
+}
+
+type panicTransport struct{}
+
+func (panicTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	panic("round trip")
+}
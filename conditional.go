@@ -0,0 +1,44 @@
+package jhttp
+
+import (
+	"net/http"
+	"time"
+)
+
+// conditional.go is used for conditional requests with ETag and Last-Modified
+
+// ETag returns the ETag response header, quotes and weak prefix included so
+// it can be sent back as is.
+func (result *Result) ETag() string {
+	return result.header.Get("ETag")
+}
+
+// LastModified returns the parsed Last-Modified response header.
+func (result *Result) LastModified() (time.Time, bool) {
+	value := result.header.Get("Last-Modified")
+	if value == "" {
+		return time.Time{}, false
+	}
+	t, err := http.ParseTime(value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// NotModified reports whether the server answered 304 Not Modified to a
+// conditional request, the body is then empty.
+func (result *Result) NotModified() bool {
+	return result.statusCode == http.StatusNotModified
+}
+
+// WithIfNoneMatch sets the If-None-Match header to an ETag from Result.ETag.
+func WithIfNoneMatch(etag string) ParamsOption {
+	return WithReqHeader("If-None-Match", etag)
+}
+
+// WithIfModifiedSince sets the If-Modified-Since header, e.g. to the time
+// from Result.LastModified.
+func WithIfModifiedSince(t time.Time) ParamsOption {
+	return WithReqHeader("If-Modified-Since", t.UTC().Format(http.TimeFormat))
+}
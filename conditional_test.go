@@ -0,0 +1,56 @@
+package jhttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConditionalRequest(t *testing.T) {
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !modified.After(since) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		_, _ = w.Write([]byte(`{"key":"k1"}`))
+	}))
+	defer server.Close()
+	client := NewClient()
+
+	resp, err := client.Get(server.URL, nil)
+	require.Nil(t, err)
+	require.Equal(t, false, resp.NotModified())
+	require.Equal(t, `{"key":"k1"}`, resp.String())
+	require.Equal(t, `"v1"`, resp.ETag())
+	lastModified, ok := resp.LastModified()
+	require.Equal(t, true, ok)
+	require.Equal(t, true, modified.Equal(lastModified))
+
+	resp, err = client.Get(server.URL, nil, WithIfNoneMatch(resp.ETag()))
+	require.Nil(t, err)
+	require.Equal(t, true, resp.NotModified())
+	require.Equal(t, "", resp.String())
+
+	resp, err = client.Get(server.URL, nil, WithIfModifiedSince(lastModified))
+	require.Nil(t, err)
+	require.Equal(t, true, resp.NotModified())
+	require.Equal(t, 3, requests)
+
+	resp, err = client.Get(server.URL, nil, WithIfModifiedSince(modified.Add(-time.Hour)))
+	require.Nil(t, err)
+	require.Equal(t, false, resp.NotModified())
+	_, ok = newTestResult(t, "").LastModified()
+	require.Equal(t, false, ok)
+}
@@ -0,0 +1,76 @@
+package jhttp
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// decode.go is used to decode response bodies by their Content-Type
+
+var ErrUnsupportedContentType = errors.New("unsupported content type")
+
+type DecodeFunc = func(result *Result, v any) error
+
+var (
+	decodersMu sync.RWMutex
+	decoders   = map[string]DecodeFunc{}
+)
+
+// RegisterDecoder registers the decoder used by Result.Decode for a media
+// type such as "application/msgpack", it overrides the built-in decoders.
+func RegisterDecoder(mediaType string, decoder DecodeFunc) {
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+	decoders[strings.ToLower(mediaType)] = decoder
+}
+
+// Decode decodes the body into v by the response Content-Type: JSON for
+// application/json and +json types, XML for application/xml, text/xml and
+// +xml types, and form values for application/x-www-form-urlencoded, where v
+// must be a *url.Values or *map[string]string.
+func (result *Result) Decode(v any) error {
+	contentType := result.Header("Content-Type")
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("%w: %q", ErrUnsupportedContentType, contentType)
+	}
+	decodersMu.RLock()
+	decoder, ok := decoders[mediaType]
+	decodersMu.RUnlock()
+	if ok {
+		return decoder(result, v)
+	}
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return result.JSON(v)
+	case mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml"):
+		return result.XML(v)
+	case mediaType == "application/x-www-form-urlencoded":
+		return result.decodeForm(v)
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedContentType, mediaType)
+	}
+}
+
+func (result *Result) decodeForm(v any) error {
+	values, err := url.ParseQuery(result.String())
+	if err != nil {
+		return err
+	}
+	switch form := v.(type) {
+	case *url.Values:
+		*form = values
+	case *map[string]string:
+		*form = make(map[string]string, len(values))
+		for key := range values {
+			(*form)[key] = values.Get(key)
+		}
+	default:
+		return fmt.Errorf("decode form: unsupported target %T", v)
+	}
+	return nil
+}
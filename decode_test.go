@@ -0,0 +1,46 @@
+package jhttp
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResultDecode(t *testing.T) {
+	var v MyStruct
+	require.Nil(t, newTestResult(t, `{"key":"k1","value":"v1"}`, "Content-Type", "application/json; charset=utf-8").Decode(&v))
+	require.Equal(t, MyStruct{Key: "k1", Value: "v1"}, v)
+
+	v = MyStruct{}
+	require.Nil(t, newTestResult(t, `{"key":"k2"}`, "Content-Type", "application/problem+json").Decode(&v))
+	require.Equal(t, "k2", v.Key)
+
+	var x struct {
+		Key string `xml:"key"`
+	}
+	require.Nil(t, newTestResult(t, `<item><key>k3</key></item>`, "Content-Type", "text/xml; charset=UTF-8").Decode(&x))
+	require.Equal(t, "k3", x.Key)
+
+	var values url.Values
+	require.Nil(t, newTestResult(t, `a=1&a=2&b=x+y`, "Content-Type", "application/x-www-form-urlencoded").Decode(&values))
+	require.Equal(t, []string{"1", "2"}, values["a"])
+	var m map[string]string
+	require.Nil(t, newTestResult(t, `a=1&b=x+y`, "Content-Type", "application/x-www-form-urlencoded").Decode(&m))
+	require.Equal(t, map[string]string{"a": "1", "b": "x y"}, m)
+
+	err := newTestResult(t, "a,b", "Content-Type", "text/csv").Decode(&v)
+	require.Equal(t, true, errors.Is(err, ErrUnsupportedContentType))
+	err = newTestResult(t, "a,b", "Content-Type", "").Decode(&v)
+	require.Equal(t, true, errors.Is(err, ErrUnsupportedContentType))
+
+	RegisterDecoder("text/csv", func(result *Result, v any) error {
+		*(v.(*[]string)) = strings.Split(result.String(), ",")
+		return nil
+	})
+	var fields []string
+	require.Nil(t, newTestResult(t, "a,b", "Content-Type", "text/csv; header=absent").Decode(&fields))
+	require.Equal(t, []string{"a", "b"}, fields)
+}
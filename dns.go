@@ -0,0 +1,166 @@
+package jhttp
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// dns.go is used to resolve the hosts requests are sent to
+
+// WithResolver resolves hosts with resolver instead of net.DefaultResolver,
+// e.g. to ask an internal DNS server.
+func WithResolver(resolver *net.Resolver) ClientOption {
+	return func(client *Client) {
+		if resolver == nil {
+			client.invalidOption("WithResolver", "nil resolver")
+			return
+		}
+		client.resolver = resolver
+		client.installDialer("WithResolver")
+	}
+}
+
+// WithDNSCache keeps the addresses of a host for ttl, concurrent lookups of a
+// host are made once. Failed lookups are not cached.
+func WithDNSCache(ttl time.Duration) ClientOption {
+	return func(client *Client) {
+		if ttl <= 0 {
+			client.invalidOption("WithDNSCache", "invalid ttl %s", ttl)
+			return
+		}
+		client.dnsCache = &dnsCache{ttl: ttl, entries: map[string]dnsEntry{}, calls: map[string]*dnsCall{}}
+		client.installDialer("WithDNSCache")
+	}
+}
+
+func (c *Client) installDialer(option string) {
+	if transport := c.ownTransport(option); transport != nil {
+		transport.DialContext = c.dialContext
+	}
+}
+
+// dialContext dials addr through the unix socket of WithUnixSocket, or from
+// the address of WithLocalAddr after resolving its host with the resolver and
+// the cache of the client, trying every address in turn.
+func (c *Client) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: c.dialTimeout, KeepAlive: defaultKeepAlive}
+	if c.unixSocket != "" {
+		return dialer.DialContext(ctx, "unix", c.unixSocket)
+	}
+	if c.localAddr != nil {
+		dialer.LocalAddr = &net.TCPAddr{IP: c.localAddr}
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil || (c.resolver == nil && c.dnsCache == nil) {
+		return dialer.DialContext(ctx, network, addr)
+	}
+	addrs, err := c.lookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	for _, ip := range addrs {
+		var conn net.Conn
+		if conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(ip, port)); err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+func (c *Client) lookupHost(ctx context.Context, host string) ([]string, error) {
+	resolver := c.resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	if c.dnsCache == nil {
+		return resolver.LookupHost(ctx, host)
+	}
+	return c.dnsCache.lookup(ctx, host, c.clock(), resolver.LookupHost)
+}
+
+type dnsCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]dnsEntry
+	// calls are the lookups in flight
+	calls map[string]*dnsCall
+}
+
+type dnsEntry struct {
+	addrs   []string
+	expires time.Time
+}
+
+type dnsCall struct {
+	done  chan struct{}
+	addrs []string
+	err   error
+}
+
+// dnsLookupTimeout limits a shared lookup, which no caller can cancel
+const dnsLookupTimeout = 30 * time.Second
+
+// lookup returns the cached addresses of host, or looks them up with resolve
+// once for all concurrent callers. The lookup is detached from the context of
+// the caller that started it, so its cancellation never fails the others, and
+// each caller stops waiting when its own context ends.
+func (d *dnsCache) lookup(ctx context.Context, host string, now time.Time, resolve func(context.Context, string) ([]string, error)) ([]string, error) {
+	d.mu.Lock()
+	if entry, ok := d.entries[host]; ok && now.Before(entry.expires) {
+		d.mu.Unlock()
+		return entry.addrs, nil
+	}
+	call, ok := d.calls[host]
+	if !ok {
+		call = &dnsCall{done: make(chan struct{})}
+		d.calls[host] = call
+		go d.resolve(detachedContext{ctx}, host, now, call, resolve)
+	}
+	d.mu.Unlock()
+	select {
+	case <-call.done:
+		return call.addrs, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// resolve makes the lookup of call and caches its addresses, expired entries
+// are evicted at the same time.
+func (d *dnsCache) resolve(ctx context.Context, host string, now time.Time, call *dnsCall, resolve func(context.Context, string) ([]string, error)) {
+	ctx, cancel := context.WithTimeout(ctx, dnsLookupTimeout)
+	defer cancel()
+	call.addrs, call.err = resolve(ctx, host)
+	d.mu.Lock()
+	delete(d.calls, host)
+	for name, entry := range d.entries {
+		if !now.Before(entry.expires) {
+			delete(d.entries, name)
+		}
+	}
+	if call.err == nil {
+		d.entries[host] = dnsEntry{addrs: call.addrs, expires: now.Add(d.ttl)}
+	}
+	d.mu.Unlock()
+	close(call.done)
+}
+
+// detachedContext keeps the values of a context but never ends, like
+// context.WithoutCancel.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
@@ -0,0 +1,173 @@
+package jhttp
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// startDNS serves A records of 127.0.0.1 for names ending with .internal. and
+// counts the A queries.
+func startDNS(t *testing.T) (*net.Resolver, *int32) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.Nil(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	var queries int32
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var msg dnsmessage.Message
+			if msg.Unpack(buf[:n]) != nil || len(msg.Questions) == 0 {
+				continue
+			}
+			question := msg.Questions[0]
+			msg.Header.Response, msg.Header.Authoritative = true, true
+			if !strings.HasSuffix(question.Name.String(), ".internal.") {
+				msg.Header.RCode = dnsmessage.RCodeNameError
+			} else if question.Type == dnsmessage.TypeA {
+				atomic.AddInt32(&queries, 1)
+				msg.Answers = []dnsmessage.Resource{{
+					Header: dnsmessage.ResourceHeader{Name: question.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 60},
+					Body:   &dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}},
+				}}
+			}
+			if packed, err := msg.Pack(); err == nil {
+				_, _ = conn.WriteTo(packed, addr)
+			}
+		}
+	}()
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "udp", conn.LocalAddr().String())
+		},
+	}
+	return resolver, &queries
+}
+
+func TestResolver(t *testing.T) {
+	resolver, queries := startDNS(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Host))
+	}))
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	url := "http://api.internal:" + port
+
+	client := NewClient(WithResolver(resolver), WithDisableKeepAlives())
+	for i := 1; i <= 2; i++ {
+		resp, err := client.Get(url, nil)
+		require.Nil(t, err)
+		require.Equal(t, "api.internal:"+port, resp.String())
+		require.Equal(t, int32(i), atomic.LoadInt32(queries))
+	}
+	_, err := client.Get("http://missing.example:"+port, nil)
+	var dnsErr *net.DNSError
+	require.ErrorAs(t, err, &dnsErr)
+}
+
+func TestDNSCache(t *testing.T) {
+	resolver, queries := startDNS(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+
+	now := time.Now()
+	client := NewClient(WithDNSCache(time.Minute), WithResolver(resolver), WithDisableKeepAlives())
+	client.now = func() time.Time {
+		return now
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.Get("http://api.internal:"+port, nil)
+			require.Nil(t, err)
+		}()
+	}
+	wg.Wait()
+	_, err := client.Get("http://api.internal:"+port, nil)
+	require.Nil(t, err)
+	require.Equal(t, int32(1), atomic.LoadInt32(queries))
+
+	// an expired entry is looked up again
+	now = now.Add(time.Minute)
+	_, err = client.Get("http://api.internal:"+port, nil)
+	require.Nil(t, err)
+	require.Equal(t, int32(2), atomic.LoadInt32(queries))
+
+	// failures are not cached
+	for i := 0; i < 2; i++ {
+		_, err = client.Get("http://missing.example:"+port, nil)
+		require.NotNil(t, err)
+	}
+	_, ok := client.dnsCache.entries["missing.example"]
+	require.Equal(t, false, ok)
+
+	require.NotNil(t, NewClient(WithDNSCache(0)).Validate())
+}
+
+func TestDNSCacheSharedLookup(t *testing.T) {
+	cache := &dnsCache{ttl: time.Minute, entries: map[string]dnsEntry{}, calls: map[string]*dnsCall{}}
+	release := make(chan struct{})
+	var lookups int32
+	resolve := func(ctx context.Context, host string) ([]string, error) {
+		atomic.AddInt32(&lookups, 1)
+		select {
+		case <-release:
+			return []string{"10.0.0.1"}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	now := time.Now()
+
+	// the caller that started the lookup cancels, the waiting one still gets
+	// the addresses
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	leaderErr := make(chan error)
+	go func() {
+		_, err := cache.lookup(leaderCtx, "api.internal", now, resolve)
+		leaderErr <- err
+	}()
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&lookups) == 1 }, time.Second, time.Millisecond)
+	waiter := make(chan []string)
+	go func() {
+		addrs, err := cache.lookup(context.Background(), "api.internal", now, resolve)
+		require.Nil(t, err)
+		waiter <- addrs
+	}()
+	cancel()
+	require.ErrorIs(t, <-leaderErr, context.Canceled)
+	close(release)
+	require.Equal(t, []string{"10.0.0.1"}, <-waiter)
+	require.Equal(t, int32(1), atomic.LoadInt32(&lookups))
+
+	// expired entries are evicted by later lookups
+	_, err := cache.lookup(context.Background(), "other.internal", now.Add(time.Minute), resolve)
+	require.Nil(t, err)
+	cache.mu.Lock()
+	_, ok := cache.entries["api.internal"]
+	require.Equal(t, false, ok)
+	require.Len(t, cache.entries, 1)
+	cache.mu.Unlock()
+}
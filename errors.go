@@ -0,0 +1,188 @@
+package jhttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// errors.go is used for the error types returned by the client
+
+// The client wraps failures with these sentinels, match them with errors.Is.
+// The underlying error, e.g. a *url.Error or context.DeadlineExceeded, stays
+// reachable through errors.Is and errors.As.
+var (
+	ErrTimeout          = errors.New("request timed out")
+	ErrRetryExhausted   = errors.New("retries exhausted")
+	ErrTooManyRedirects = errors.New("too many redirects")
+	ErrResponseTooLarge = errors.New("response body too large")
+	ErrCircuitOpen      = errors.New("circuit breaker open")
+	ErrPinMismatch      = errors.New("no pinned certificate")
+)
+
+// The phases of a PhaseError.
+const (
+	PhaseDial           = "dial"
+	PhaseTLSHandshake   = "tls handshake"
+	PhaseResponseHeader = "response header"
+)
+
+// PhaseError is returned when a request fails before its response headers
+// arrived, Phase tells which step of sending it failed, e.g. PhaseDial. Match
+// it with errors.As, a timeout still matches ErrTimeout.
+type PhaseError struct {
+	Phase string
+	Err   error
+}
+
+func (e *PhaseError) Error() string {
+	return e.Phase + ": " + e.Err.Error()
+}
+
+func (e *PhaseError) Unwrap() error {
+	return e.Err
+}
+
+// defaultMaxErrorBodyBytes is how much of a failed response body is kept on a
+// StatusError by default.
+const defaultMaxErrorBodyBytes = 64 * 1024
+
+// maxDrainBytes is how much of an error body past the limit is discarded so
+// the connection can be reused, the connection of a larger body is closed.
+const maxDrainBytes = 64 * 1024
+
+// StatusError is returned when the response status causes a request to fail,
+// Body holds at most WithMaxErrorBodyBytes bytes of the response body.
+type StatusError struct {
+	Code   int
+	Status string
+	Header http.Header
+	Body   []byte
+	// Truncated is set when the response body was longer than Body
+	Truncated bool
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("status code: %d", e.Code)
+}
+
+func newStatusError(code int, status string, header http.Header, body []byte, limit int64) *StatusError {
+	if int64(len(body)) > limit {
+		body = body[:limit]
+	}
+	var kept []byte
+	if len(body) > 0 {
+		kept = make([]byte, len(body))
+		copy(kept, body)
+	}
+	return &StatusError{Code: code, Status: status, Header: header, Body: kept}
+}
+
+// Attempt records a failed attempt of a request.
+type Attempt struct {
+	// Attempt is 1 for the first try
+	Attempt  int
+	Time     time.Time
+	Duration time.Duration
+	// StatusCode is zero when no response was received
+	StatusCode int
+	Err        error
+}
+
+// RetryExhaustedError is returned when every attempt of a retried request
+// failed, it matches ErrRetryExhausted and unwraps to the last attempt error.
+type RetryExhaustedError struct {
+	Attempts []Attempt
+	// Elapsed is the time since the first attempt started
+	Elapsed time.Duration
+}
+
+func (e *RetryExhaustedError) Error() string {
+	return fmt.Sprintf("%s after %d attempts: %v", ErrRetryExhausted, len(e.Attempts), e.Unwrap())
+}
+
+func (e *RetryExhaustedError) Is(target error) bool {
+	return target == ErrRetryExhausted
+}
+
+func (e *RetryExhaustedError) Unwrap() error {
+	if len(e.Attempts) == 0 {
+		return nil
+	}
+	return e.Attempts[len(e.Attempts)-1].Err
+}
+
+func newAttempt(i int, start, end time.Time, result *Result, err error) Attempt {
+	attempt := Attempt{Attempt: i + 1, Time: start, Duration: end.Sub(start), Err: err}
+	var se *StatusError
+	if result != nil {
+		attempt.StatusCode = result.statusCode
+	} else if errors.As(err, &se) {
+		attempt.StatusCode = se.Code
+	}
+	return attempt
+}
+
+// readErrorBody reads at most limit bytes of an error body and closes it.
+func readErrorBody(body io.ReadCloser, limit int64) ([]byte, bool) {
+	defer func() {
+		_ = body.Close()
+	}()
+	data, _ := io.ReadAll(io.LimitReader(body, limit+1))
+	truncated := int64(len(data)) > limit
+	if truncated {
+		data = data[:limit]
+		_, _ = io.CopyN(io.Discard, body, maxDrainBytes)
+	}
+	return data, truncated
+}
+
+// newErrorResult returns a Result of a failed response with at most limit
+// bytes of its body.
+func newErrorResult(resp *http.Response, limit int64) (*Result, bool) {
+	result := newResult(resp)
+	var truncated bool
+	result.cache, truncated = readErrorBody(resp.Body, limit)
+	return result, truncated
+}
+
+// sentinelError matches sentinel with errors.Is and unwraps to err.
+type sentinelError struct {
+	sentinel error
+	err      error
+}
+
+func (e *sentinelError) Error() string {
+	return e.sentinel.Error() + ": " + e.err.Error()
+}
+
+func (e *sentinelError) Is(target error) bool {
+	// every timeout is a deadline, e.g. the http.Client Timeout
+	return target == e.sentinel || (e.sentinel == ErrTimeout && target == context.DeadlineExceeded)
+}
+
+func (e *sentinelError) Unwrap() error {
+	return e.err
+}
+
+func wrapSentinel(sentinel, err error) error {
+	if err == nil || errors.Is(err, sentinel) {
+		return err
+	}
+	return &sentinelError{sentinel: sentinel, err: err}
+}
+
+// wrapTransportError wraps the timeouts of sending a request or reading its
+// response with ErrTimeout, which also matches context.DeadlineExceeded. A
+// cancellation is kept as is and only matches context.Canceled.
+func wrapTransportError(err error) error {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return wrapSentinel(ErrTimeout, err)
+	}
+	return err
+}
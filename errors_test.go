@@ -0,0 +1,289 @@
+package jhttp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			w.Header().Set("X-Request-Id", "r1")
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":"not found"}`))
+		case "/large":
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(strings.Repeat("x", 1024)))
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		path   string
+		opts   []ClientOption
+		code   int
+		status string
+		body   string
+	}{
+		{name: "4xx with body", path: "/missing", code: 404, status: "404 Not Found", body: `{"error":"not found"}`},
+		{name: "5xx without body", path: "/unavailable", code: 503, status: "503 Service Unavailable"},
+		{name: "capped body", path: "/large", opts: []ClientOption{WithMaxErrorBodyBytes(10)}, code: 400, status: "400 Bad Request", body: "xxxxxxxxxx"},
+		{name: "result on error", path: "/missing", opts: []ClientOption{WithReturnResultOnError()}, code: 404, status: "404 Not Found", body: `{"error":"not found"}`},
+		{name: "no body kept", path: "/missing", opts: []ClientOption{WithMaxErrorBodyBytes(0)}, code: 404, status: "404 Not Found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewClient(tt.opts...).Get(server.URL+tt.path, nil)
+			var se *StatusError
+			require.Equal(t, true, errors.As(err, &se))
+			require.Equal(t, tt.code, se.Code)
+			require.Equal(t, tt.status, se.Status)
+			require.Equal(t, tt.body, string(se.Body))
+			require.Equal(t, tt.name == "capped body" || tt.name == "no body kept", se.Truncated)
+			require.Contains(t, se.Error(), "status code: ")
+			if tt.path == "/missing" {
+				require.Equal(t, "r1", se.Header.Get("X-Request-Id"))
+			}
+		})
+	}
+}
+
+func TestSentinelErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow":
+			time.Sleep(200 * time.Millisecond)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		case "/large":
+			_, _ = w.Write([]byte(strings.Repeat("x", 1024)))
+		case "/fail":
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+	// a closed listener refuses connections
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	refused := "http://" + listener.Addr().String()
+	require.Nil(t, listener.Close())
+
+	tests := []struct {
+		name     string
+		client   *Client
+		url      string
+		opts     []ParamsOption
+		sentinel error
+		match    func(t *testing.T, err error)
+	}{
+		{
+			name:     "request timeout",
+			client:   NewClient(),
+			url:      server.URL + "/slow",
+			opts:     []ParamsOption{WithRequestTimeout(50 * time.Millisecond)},
+			sentinel: ErrTimeout,
+			match: func(t *testing.T, err error) {
+				require.Equal(t, true, errors.Is(err, context.DeadlineExceeded))
+			},
+		},
+		{
+			name:     "too many redirects",
+			client:   NewClient(),
+			url:      server.URL + "/loop",
+			sentinel: ErrTooManyRedirects,
+			match: func(t *testing.T, err error) {
+				var urlErr *url.Error
+				require.Equal(t, true, errors.As(err, &urlErr))
+			},
+		},
+		{
+			name:     "response too large",
+			client:   NewClient(WithMaxResponseBytes(10)),
+			url:      server.URL + "/large",
+			sentinel: ErrResponseTooLarge,
+		},
+		{
+			name:     "retry exhausted",
+			client:   NewClient(SetRetry(1)),
+			url:      server.URL + "/fail",
+			sentinel: ErrRetryExhausted,
+			match: func(t *testing.T, err error) {
+				var se *StatusError
+				require.Equal(t, true, errors.As(err, &se))
+				require.Equal(t, http.StatusBadGateway, se.Code)
+			},
+		},
+		{
+			name:   "connection refused",
+			client: NewClient(),
+			url:    refused,
+			match: func(t *testing.T, err error) {
+				var opErr *net.OpError
+				require.Equal(t, true, errors.As(err, &opErr))
+			},
+		},
+	}
+	sentinels := []error{ErrTimeout, ErrRetryExhausted, ErrTooManyRedirects, ErrResponseTooLarge, ErrCircuitOpen, ErrPinMismatch}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.client.Get(tt.url, nil, tt.opts...)
+			require.NotNil(t, err)
+			for _, sentinel := range sentinels {
+				require.Equal(t, sentinel == tt.sentinel, errors.Is(err, sentinel), sentinel.Error())
+			}
+			if tt.match != nil {
+				tt.match(t, err)
+			}
+		})
+	}
+}
+
+func TestRetryExhaustedError(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&requests, 1) {
+		case 1:
+			w.WriteHeader(http.StatusBadGateway)
+		case 2:
+			time.Sleep(300 * time.Millisecond)
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	client := NewClient(SetRetry(2))
+
+	start := time.Now()
+	_, err := client.Get(server.URL, nil, WithRequestTimeout(100*time.Millisecond))
+	require.NotNil(t, err)
+	require.Equal(t, true, errors.Is(err, ErrRetryExhausted))
+	var retryErr *RetryExhaustedError
+	require.Equal(t, true, errors.As(err, &retryErr))
+	require.Len(t, retryErr.Attempts, 3)
+	require.Contains(t, err.Error(), "after 3 attempts")
+
+	codes := []int{http.StatusBadGateway, 0, http.StatusServiceUnavailable}
+	for i, attempt := range retryErr.Attempts {
+		require.Equal(t, i+1, attempt.Attempt)
+		require.Equal(t, codes[i], attempt.StatusCode)
+		require.NotNil(t, attempt.Err)
+		require.Equal(t, false, attempt.Time.Before(start))
+		start = attempt.Time
+	}
+	require.Equal(t, true, errors.Is(retryErr.Attempts[1].Err, ErrTimeout))
+	require.GreaterOrEqual(t, retryErr.Attempts[1].Duration, 100*time.Millisecond)
+
+	// the last attempt error is still reachable
+	var se *StatusError
+	require.Equal(t, true, errors.As(err, &se))
+	require.Equal(t, http.StatusServiceUnavailable, se.Code)
+}
+
+func TestRequestErrorContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	_, err := NewClient().Get(server.URL+"/v1/users?token=secret", nil, WithRequestTimeout(50*time.Millisecond))
+	require.NotNil(t, err)
+	require.Equal(t, true, strings.HasPrefix(err.Error(), "jhttp: GET "+host+"/v1/users: "), err.Error())
+	require.NotContains(t, err.Error(), "secret")
+	require.Equal(t, true, errors.Is(err, context.DeadlineExceeded))
+	require.Equal(t, true, errors.Is(err, ErrTimeout))
+
+	_, err = NewClient(WithFullURLInErrors()).Post(server.URL+"/v1/users", nil,
+		AddParams("token", "secret"), WithRequestTimeout(50*time.Millisecond))
+	require.NotNil(t, err)
+	require.Equal(t, true, strings.HasPrefix(err.Error(), "jhttp: POST "+server.URL+"/v1/users?token=secret: "), err.Error())
+	require.Equal(t, true, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestContextErrors(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(500 * time.Millisecond):
+		}
+	}))
+	defer server.Close()
+
+	// a cancellation is not retried
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_, err := NewClient(SetRetry(2)).Get(server.URL, nil, WithRequestContext(ctx))
+	require.Equal(t, true, errors.Is(err, context.Canceled))
+	require.Equal(t, false, errors.Is(err, context.DeadlineExceeded))
+	require.Equal(t, false, errors.Is(err, ErrTimeout))
+	require.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	// an attempt deadline is retried
+	atomic.StoreInt32(&requests, 0)
+	_, err = NewClient(SetRetry(1)).Get(server.URL, nil, WithRequestTimeout(50*time.Millisecond))
+	require.Equal(t, true, errors.Is(err, context.DeadlineExceeded))
+	require.Equal(t, true, errors.Is(err, ErrTimeout))
+	require.Equal(t, false, errors.Is(err, context.Canceled))
+	require.Equal(t, int32(2), atomic.LoadInt32(&requests))
+
+	// the http.Client Timeout is a deadline too
+	client := NewClient()
+	client.http = &http.Client{Timeout: 50 * time.Millisecond}
+	_, err = client.Get(server.URL, nil)
+	require.Equal(t, true, errors.Is(err, context.DeadlineExceeded))
+	require.Equal(t, true, errors.Is(err, ErrTimeout))
+	require.Equal(t, false, errors.Is(err, context.Canceled))
+}
+
+func TestMaxErrorBodyBytes(t *testing.T) {
+	size := 10 * 1024 * 1024
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		chunk := []byte(strings.Repeat("x", 64*1024))
+		for written := 0; written < size; written += len(chunk) {
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	for _, client := range []*Client{NewClient(), NewClient(WithReturnResultOnError())} {
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		resp, err := client.Get(server.URL, nil)
+		runtime.ReadMemStats(&after)
+		require.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(2*1024*1024))
+		var se *StatusError
+		require.Equal(t, true, errors.As(err, &se))
+		require.Equal(t, true, se.Truncated)
+		require.Len(t, se.Body, defaultMaxErrorBodyBytes)
+		if resp != nil {
+			require.Len(t, resp.Bytes(), defaultMaxErrorBodyBytes)
+		}
+	}
+
+	_, err := NewClient(WithMaxErrorBodyBytes(16)).Get(server.URL, nil)
+	var se *StatusError
+	require.Equal(t, true, errors.As(err, &se))
+	require.Equal(t, true, se.Truncated)
+	require.Equal(t, strings.Repeat("x", 16), string(se.Body))
+}
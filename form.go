@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"mime"
 	"mime/multipart"
+	"net/http"
 	"net/textproto"
 	"os"
 	"path/filepath"
@@ -36,6 +38,7 @@ type (
 		fields     []string
 		values     []string
 		fieldTypes []FieldType
+		detect     bool
 	}
 )
 type FormData struct {
@@ -78,6 +81,14 @@ func AddFormParams(field string, value string, fieldType FieldType) FormOption {
 	}
 }
 
+// detectContentType types a file of an extension unknown to getContentType by
+// the system MIME table, then by its content, instead of as Byte.
+func detectContentType() FormOption {
+	return func(form *form) {
+		form.detect = true
+	}
+}
+
 func (f form) build() (*FormData, error) {
 	var b bytes.Buffer
 	w := multipart.NewWriter(&b)
@@ -93,6 +104,12 @@ func (f form) build() (*FormData, error) {
 			}
 			fileName := filepath.Base(value)
 			contentType := getContentType(fileName)
+			if contentType == Byte && f.detect {
+				contentType = ContentType(mime.TypeByExtension(filepath.Ext(fileName)))
+				if contentType == "" {
+					contentType = ContentType(http.DetectContentType(file))
+				}
+			}
 			part, err := createFormFile(field, fileName, string(contentType), w)
 			if err != nil {
 				return nil, err
@@ -119,16 +136,12 @@ func (f form) build() (*FormData, error) {
 }
 
 func getContentType(filename string) ContentType {
-	str := strings.Split(filename, ".")
-	if len(str) != 2 {
-		return Byte
-	}
-	switch str[1] {
-	case "zip":
+	switch filepath.Ext(filename) {
+	case ".zip":
 		return Zip
-	case "json":
+	case ".json":
 		return Json
-	case "xml":
+	case ".xml":
 		return XML
 	default:
 		return Byte
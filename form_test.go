@@ -2,6 +2,12 @@ package jhttp
 
 import (
 	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -15,3 +21,69 @@ func TestNewFormParams(t *testing.T) {
 	require.Nil(t, err)
 	fmt.Println(formParams.buf.String())
 }
+
+func TestFormDataRetry(t *testing.T) {
+	var bodies [][]byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, body)
+		if len(bodies) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	formParams, err := NewFormParams(AddFormParams("username", "username", Text))
+	require.Nil(t, err)
+	client := NewClient(SetRetry(1), WithRetryNonIdempotent())
+	recordSleeps(client)
+	_, err = client.Post(server.URL, formParams)
+	require.Nil(t, err)
+	require.Len(t, bodies, 2)
+	require.NotEmpty(t, bodies[0])
+	require.Equal(t, bodies[0], bodies[1])
+
+	// the form can be sent again
+	_, err = client.Post(server.URL, formParams)
+	require.Nil(t, err)
+	require.Equal(t, bodies[0], bodies[2])
+}
+
+func TestFormFileContentType(t *testing.T) {
+	dir := t.TempDir()
+	jsonPath := filepath.Join(dir, "report.v2.json")
+	require.Nil(t, os.WriteFile(jsonPath, []byte(`{"ok":true}`), 0o600))
+	plainPath := filepath.Join(dir, "notes")
+	require.Nil(t, os.WriteFile(plainPath, []byte("hello world"), 0o600))
+
+	// NewFormParams only knows zip, json and xml, it never sniffs
+	formParams, err := NewFormParams(AddFormParams("a", jsonPath, File), AddFormParams("b", plainPath, File))
+	require.Nil(t, err)
+	reader := multipart.NewReader(formParams.buf, formParams.writer.Boundary())
+	var types []string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.Nil(t, err)
+		types = append(types, part.Header.Get("Content-Type"))
+	}
+	require.Equal(t, []string{string(Json), string(Byte)}, types)
+
+	// PostFile sniffs the content of a file of unknown extension
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, header, err := r.FormFile("upload")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(header.Header.Get("Content-Type")))
+	}))
+	defer server.Close()
+	resp, err := NewClient().PostFile(server.URL, "upload", plainPath, nil)
+	require.Nil(t, err)
+	require.Equal(t, "text/plain; charset=utf-8", resp.String())
+}
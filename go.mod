@@ -6,6 +6,8 @@ require (
 	github.com/gorilla/websocket v1.5.1-0.20220712153730-af47554f343b
 	github.com/stretchr/testify v1.8.0
 	github.com/tidwall/gjson v1.14.3
+	golang.org/x/net v0.19.0
+	golang.org/x/text v0.14.0
 )
 
 require (
@@ -0,0 +1,95 @@
+package jhttp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// hedge.go is used to race copies of a slow request
+
+// WithHedging sends another copy of a GET or HEAD request whenever no copy has
+// answered within delay, up to maxExtra copies. The first successful response
+// wins and the other copies are cancelled. The copies count as one attempt,
+// a retry hedges again.
+func WithHedging(delay time.Duration, maxExtra int) ParamsOption {
+	return func(r *request) {
+		if r.method != http.MethodGet && r.method != http.MethodHead {
+			r.err = fmt.Errorf("hedging needs a GET or HEAD request, not %s", r.method)
+			return
+		}
+		if delay <= 0 || maxExtra < 0 {
+			r.err = fmt.Errorf("invalid hedging delay %s or copies %d", delay, maxExtra)
+			return
+		}
+		r.hedgeDelay, r.hedgeExtra = delay, maxExtra
+	}
+}
+
+type hedgeResult struct {
+	result *Result
+	err    error
+	// n is the copy that sent the request
+	n int
+}
+
+// hedge makes one hedged attempt with send. It returns the first successful
+// response with the cancel func of its context, or the failure of the last
+// copy once every copy failed.
+func (c *Client) hedge(ctx context.Context, r *request, send func(context.Context) (*Result, error)) (*Result, context.CancelFunc, error) {
+	// buffered, so a losing copy never blocks
+	results := make(chan hedgeResult, r.hedgeExtra+1)
+	var cancels []context.CancelFunc
+	launch := func() {
+		attemptCtx, cancel := r.attemptContext(ctx)
+		cancels = append(cancels, cancel)
+		go func(n int) {
+			result, err := send(attemptCtx)
+			results <- hedgeResult{result: result, err: err, n: n}
+		}(len(cancels) - 1)
+	}
+	launch()
+	timer := time.NewTimer(r.hedgeDelay)
+	defer timer.Stop()
+	var last hedgeResult
+	for pending := 1; pending > 0; {
+		select {
+		case <-timer.C:
+			if len(cancels) <= r.hedgeExtra {
+				launch()
+				pending++
+				timer.Reset(r.hedgeDelay)
+			}
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				for n, cancel := range cancels {
+					if n != res.n {
+						cancel()
+					}
+				}
+				go closeHedged(results, pending)
+				return res.result, cancels[res.n], nil
+			}
+			if last.result != nil {
+				_ = last.result.Close()
+			}
+			last = res
+		}
+	}
+	return last.result, func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+	}, last.err
+}
+
+// closeHedged closes the responses of the n copies that lost the race.
+func closeHedged(results <-chan hedgeResult, n int) {
+	for ; n > 0; n-- {
+		if res := <-results; res.result != nil {
+			_ = res.result.Close()
+		}
+	}
+}
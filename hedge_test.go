@@ -0,0 +1,67 @@
+package jhttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHedging(t *testing.T) {
+	var count, cancelled int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the first copy hangs until it is cancelled
+		if atomic.AddInt32(&count, 1) == 1 {
+			select {
+			case <-r.Context().Done():
+				atomic.AddInt32(&cancelled, 1)
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		_, _ = w.Write([]byte("fast"))
+	}))
+	defer server.Close()
+
+	client := NewClient()
+	start := time.Now()
+	resp, err := client.Get(server.URL, nil, WithHedging(50*time.Millisecond, 1))
+	require.Nil(t, err)
+	require.Equal(t, "fast", resp.String())
+	require.Equal(t, 1, resp.Attempts())
+	require.Less(t, time.Since(start), time.Second)
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&cancelled) == 1
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, int32(2), atomic.LoadInt32(&count))
+
+	_, err = client.Post(server.URL, nil, WithHedging(time.Second, 1))
+	require.ErrorContains(t, err, "hedging needs a GET or HEAD request")
+	_, err = client.Get(server.URL, nil, WithHedging(0, 1))
+	require.NotNil(t, err)
+}
+
+func TestHedgingRetry(t *testing.T) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the first hedged pair fails
+		if atomic.AddInt32(&count, 1) <= 2 {
+			time.Sleep(20 * time.Millisecond)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	client := NewClient(SetRetry(1))
+	sleeps := recordSleeps(client)
+	resp, err := client.Get(server.URL, nil, WithHedging(time.Millisecond, 1))
+	require.Nil(t, err)
+	require.Equal(t, "ok", resp.String())
+	require.Equal(t, 2, resp.Attempts())
+	require.Len(t, *sleeps, 1)
+}
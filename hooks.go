@@ -0,0 +1,76 @@
+package jhttp
+
+import (
+	"log"
+	"net/http"
+	"time"
+)
+
+// hooks.go is used to observe the attempts of a client
+
+// WithOnRequest calls hook right before every attempt is sent, retries
+// included. The header is a copy, the hook cannot change the request, with the
+// credentials of the Authorization, Proxy-Authorization and Cookie headers
+// redacted. The url has its query redacted unless WithFullURLInErrors is set.
+func WithOnRequest(hook func(method, url string, header http.Header)) ClientOption {
+	return func(client *Client) {
+		client.onRequest = hook
+	}
+}
+
+// WithOnResponse calls hook after every attempt got its response headers, or
+// failed without a response, then status is zero. dur is measured from
+// sending the request, see WithOnRequest for the url.
+func WithOnResponse(hook func(method, url string, status int, dur time.Duration)) ClientOption {
+	return func(client *Client) {
+		client.onResponse = hook
+	}
+}
+
+// notifyRequest calls the OnRequest hook, a panic in the hook is logged and
+// the request is sent anyway.
+func (c *Client) notifyRequest(req *http.Request) {
+	if c.onRequest == nil {
+		return
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("jhttp: recovered panic in OnRequest hook: %v", p)
+		}
+	}()
+	c.onRequest(req.Method, c.errorURL(req.URL.String()), redactHeader(req.Header))
+}
+
+// credentialHeaders are redacted in the headers given to hooks
+var credentialHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+// redactedValue replaces a credential in the headers given to hooks
+const redactedValue = "[REDACTED]"
+
+// redactHeader returns a copy of header with its credentials redacted.
+func redactHeader(header http.Header) http.Header {
+	redacted := header.Clone()
+	for _, key := range credentialHeaders {
+		if _, ok := redacted[key]; ok {
+			redacted[key] = []string{redactedValue}
+		}
+	}
+	return redacted
+}
+
+// notifyResponse calls the OnResponse hook, a panic in the hook is logged.
+func (c *Client) notifyResponse(req *http.Request, resp *http.Response, dur time.Duration) {
+	if c.onResponse == nil {
+		return
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("jhttp: recovered panic in OnResponse hook: %v", p)
+		}
+	}()
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	c.onResponse(req.Method, c.errorURL(req.URL.String()), status, dur)
+}
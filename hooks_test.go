@@ -0,0 +1,95 @@
+package jhttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLifecycleHooks(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			time.Sleep(10 * time.Millisecond)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	type requestEvent struct {
+		method, url, header string
+		// credentials sent with the request
+		auth, cookie string
+	}
+	type responseEvent struct {
+		method, url string
+		status      int
+		dur         time.Duration
+	}
+	var requestEvents []requestEvent
+	var headers []http.Header
+	var responseEvents []responseEvent
+	client := NewClient(SetRetry(1), WithRetryWait(0, 0), AddHeader("X-Test", "yes"), WithBasicAuth("user", "secret"),
+		WithOnRequest(func(method, url string, header http.Header) {
+			headers = append(headers, header.Clone())
+			requestEvents = append(requestEvents, requestEvent{method: method, url: url, header: header.Get("X-Test"),
+				auth: header.Get("Authorization"), cookie: header.Get("Cookie")})
+			// the hook only gets a copy
+			header.Set("X-Test", "changed")
+		}),
+		WithOnResponse(func(method, url string, status int, dur time.Duration) {
+			responseEvents = append(responseEvents, responseEvent{method: method, url: url, status: status, dur: dur})
+		}),
+	)
+	client.AddCookie([]*http.Cookie{{Name: "session", Value: "secret"}})
+	resp, err := client.Get(server.URL+"/items?token=secret", nil)
+	require.Nil(t, err)
+	require.Equal(t, 2, resp.Attempts())
+
+	require.Equal(t, []requestEvent{
+		{method: http.MethodGet, url: server.URL + "/items", header: "yes", auth: "[REDACTED]", cookie: "[REDACTED]"},
+		{method: http.MethodGet, url: server.URL + "/items", header: "yes", auth: "[REDACTED]", cookie: "[REDACTED]"},
+	}, requestEvents)
+	require.Len(t, responseEvents, 2)
+	require.Equal(t, http.StatusServiceUnavailable, responseEvents[0].status)
+	require.Equal(t, http.StatusOK, responseEvents[1].status)
+	require.Equal(t, server.URL+"/items", responseEvents[1].url)
+	require.GreaterOrEqual(t, responseEvents[0].dur, 10*time.Millisecond)
+	require.Greater(t, responseEvents[1].dur, responseEvents[0].dur)
+
+	requestEvents = nil
+	_, err = client.Get(server.URL, nil, WithReqHeader("Proxy-Authorization", "Basic secret"))
+	require.Nil(t, err)
+	require.Len(t, requestEvents, 1)
+	require.Equal(t, "[REDACTED]", headers[len(headers)-1].Get("Proxy-Authorization"))
+	// no credential reaches the hook
+	for _, header := range headers {
+		for key, values := range header {
+			for _, value := range values {
+				require.NotContains(t, value, "secret", key)
+			}
+		}
+	}
+
+	// a failed attempt has no status
+	responseEvents = nil
+	_, err = client.Get("http://127.0.0.1:0", nil, WithReqRetryable(false))
+	require.NotNil(t, err)
+	require.Len(t, responseEvents, 1)
+	require.Equal(t, 0, responseEvents[0].status)
+
+	// a panicking hook does not fail the request
+	atomic.StoreInt32(&requests, 1)
+	panicking := NewClient(
+		WithOnRequest(func(string, string, http.Header) { panic("request hook") }),
+		WithOnResponse(func(string, string, int, time.Duration) { panic("response hook") }),
+	)
+	_, err = panicking.Get(server.URL, nil)
+	require.Nil(t, err)
+}
@@ -0,0 +1,149 @@
+package jhttp
+
+import (
+	"container/list"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// host.go is used to send requests with another Host than the one of the url
+
+// WithHostOverride sends every request with Host set to host, e.g. to reach a
+// virtual host through the IP of a load balancer. For https the TLS server
+// name, used for SNI and to verify the certificate, is host too, see
+// WithHostOverrideSNI. A Host header set with WithReqHeader or
+// WithReqHostOverride takes precedence.
+func WithHostOverride(host string) ClientOption {
+	return func(client *Client) {
+		client.hostOverride = host
+	}
+}
+
+// WithReqHostOverride sends the request with Host set to host, see
+// WithHostOverride.
+func WithReqHostOverride(host string) ParamsOption {
+	return func(r *request) {
+		r.hostOverride = host
+	}
+}
+
+// WithHostOverrideSNI decides whether an overridden Host is also the TLS
+// server name, it is by default. Disabled, the certificate is verified against
+// the host of the url.
+func WithHostOverrideSNI(enabled bool) ClientOption {
+	return func(client *Client) {
+		client.noHostOverrideSNI = !enabled
+	}
+}
+
+// hostOverrideOf returns the Host to send instead of the one of the url, the
+// Host header cannot be sent as a header so it is removed from req.
+func (c *Client) hostOverrideOf(req *http.Request, r *request) string {
+	host := req.Header.Get("Host")
+	req.Header.Del("Host")
+	if c.hostOverride != "" && r.header.Get("Host") == "" {
+		host = c.hostOverride
+	}
+	if r.hostOverride != "" {
+		host = r.hostOverride
+	}
+	return host
+}
+
+// maxHostTransports bounds the transports kept for other TLS server names, the
+// least recently used one is dropped beyond it.
+const maxHostTransports = 16
+
+// hostTransports are the clones of the transport of a client that use
+// another TLS server name, a connection is only reused for the same name.
+type hostTransports struct {
+	mu     sync.Mutex
+	base   *http.Transport
+	byName map[string]*list.Element
+	// order holds the *hostTransport of byName, most recently used first
+	order *list.List
+}
+
+type hostTransport struct {
+	name      string
+	transport *http.Transport
+	rt        http.RoundTripper
+}
+
+// serverNameTransport returns the transport of httpClient using the server
+// name of host, wrapped by the round tripper middlewares. It returns nil when
+// the transport already uses it or is a RoundTripper other than
+// *http.Transport.
+func (c *Client) serverNameTransport(httpClient *http.Client, host string) http.RoundTripper {
+	rt := httpClient.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	base, ok := rt.(*http.Transport)
+	if !ok {
+		return nil
+	}
+	name := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		name = h
+	}
+	if base.TLSClientConfig != nil && base.TLSClientConfig.ServerName == name {
+		return nil
+	}
+	return c.serverNameTransports().transport(base, name, c.wrapRoundTripper)
+}
+
+// zeroHostTransports are the transports of a Client not made by NewClient,
+// such clients share them.
+var zeroHostTransports hostTransports
+
+func (c *Client) serverNameTransports() *hostTransports {
+	if c.hostTransports == nil {
+		return &zeroHostTransports
+	}
+	return c.hostTransports
+}
+
+func (h *hostTransports) transport(base *http.Transport, name string, wrap func(http.RoundTripper) http.RoundTripper) http.RoundTripper {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.base != base {
+		h.closeIdleConnectionsLocked()
+		h.base, h.byName, h.order = base, map[string]*list.Element{}, list.New()
+	}
+	if elem, ok := h.byName[name]; ok {
+		h.order.MoveToFront(elem)
+		return elem.Value.(*hostTransport).rt
+	}
+	transport := base.Clone()
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	transport.TLSClientConfig.ServerName = name
+	entry := &hostTransport{name: name, transport: transport, rt: wrap(transport)}
+	h.byName[name] = h.order.PushFront(entry)
+	if h.order.Len() > maxHostTransports {
+		oldest := h.order.Remove(h.order.Back()).(*hostTransport)
+		delete(h.byName, oldest.name)
+		oldest.transport.CloseIdleConnections()
+	}
+	return entry.rt
+}
+
+// closeIdleConnections closes the idle connections of every transport.
+func (h *hostTransports) closeIdleConnections() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closeIdleConnectionsLocked()
+}
+
+func (h *hostTransports) closeIdleConnectionsLocked() {
+	if h.order == nil {
+		return
+	}
+	for elem := h.order.Front(); elem != nil; elem = elem.Next() {
+		elem.Value.(*hostTransport).transport.CloseIdleConnections()
+	}
+}
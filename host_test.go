@@ -0,0 +1,125 @@
+package jhttp
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostOverride(t *testing.T) {
+	// a name-based virtual host handler
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Host {
+		case "api.example.com":
+			_, _ = w.Write([]byte("api"))
+		case "www.example.com":
+			_, _ = w.Write([]byte("www"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		client *Client
+		opts   []ParamsOption
+		want   string
+	}{
+		{name: "client", client: NewClient(WithHostOverride("api.example.com")), want: "api"},
+		{name: "request", client: NewClient(), opts: []ParamsOption{WithReqHostOverride("www.example.com")}, want: "www"},
+		{name: "request over client", client: NewClient(WithHostOverride("api.example.com")), opts: []ParamsOption{WithReqHostOverride("www.example.com")}, want: "www"},
+		{name: "client header", client: NewClient(AddHeader("Host", "api.example.com")), want: "api"},
+		{name: "request header over client", client: NewClient(WithHostOverride("api.example.com")), opts: []ParamsOption{WithReqHeader("Host", "www.example.com")}, want: "www"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := tt.client.Get(server.URL+"/health", nil, tt.opts...)
+			require.Nil(t, err)
+			require.Equal(t, tt.want, resp.String())
+		})
+	}
+	_, err := NewClient().Get(server.URL, nil)
+	var se *StatusError
+	require.ErrorAs(t, err, &se)
+	require.Equal(t, http.StatusNotFound, se.Code)
+}
+
+func TestHostOverrideTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Host + " " + r.TLS.ServerName))
+	}))
+	defer server.Close()
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+	addr := strings.TrimPrefix(server.URL, "https://")
+
+	// the test certificate is valid for *.example.com and 127.0.0.1
+	client := NewClient(WithRootCAs(pool))
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(server.URL, nil, WithReqHostOverride("example.com"))
+		require.Nil(t, err)
+		require.Equal(t, "example.com example.com", resp.String())
+		// the connection of the override is not reused without it
+		resp, err = client.Get(server.URL, nil)
+		require.Nil(t, err)
+		require.Equal(t, addr+" ", resp.String())
+	}
+
+	resp, err := NewClient(WithRootCAs(pool), WithHostOverride("example.com:443")).Get(server.URL, nil)
+	require.Nil(t, err)
+	require.Equal(t, "example.com:443 example.com", resp.String())
+
+	resp, err = NewClient(WithRootCAs(pool), WithHostOverrideSNI(false)).Get(server.URL, nil, WithReqHostOverride("api.example.com"))
+	require.Nil(t, err)
+	require.Equal(t, "api.example.com ", resp.String())
+
+	// the certificate is verified against the overridden name
+	_, err = NewClient(WithRootCAs(pool)).Get(server.URL, nil, WithReqHostOverride("api.example.org"))
+	require.NotNil(t, err)
+}
+
+func TestHostOverrideTransports(t *testing.T) {
+	var conns int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.TLS.ServerName))
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	server.StartTLS()
+	defer server.Close()
+	client := NewClient(WithInsecureSkipVerify())
+
+	// the transports of other server names are bounded
+	for i := 0; i < 2*maxHostTransports; i++ {
+		name := fmt.Sprintf("tenant-%d.example.com", i)
+		resp, err := client.Get(server.URL, nil, WithReqHostOverride(name))
+		require.Nil(t, err)
+		require.Equal(t, name, resp.String())
+	}
+	require.Len(t, client.hostTransports.byName, maxHostTransports)
+	require.Equal(t, maxHostTransports, client.hostTransports.order.Len())
+	_, ok := client.hostTransports.byName["tenant-0.example.com"]
+	require.Equal(t, false, ok)
+
+	// a new connection is needed once the idle ones are closed
+	atomic.StoreInt32(&conns, 0)
+	name := fmt.Sprintf("tenant-%d.example.com", 2*maxHostTransports-1)
+	_, err := client.Get(server.URL, nil, WithReqHostOverride(name))
+	require.Nil(t, err)
+	require.Equal(t, int32(0), atomic.LoadInt32(&conns))
+	client.CloseIdleConnections()
+	_, err = client.Get(server.URL, nil, WithReqHostOverride(name))
+	require.Nil(t, err)
+	require.Equal(t, int32(1), atomic.LoadInt32(&conns))
+}
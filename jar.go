@@ -0,0 +1,33 @@
+package jhttp
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// jar.go is used to keep the cookies of a session
+
+// WithCookieJar stores the cookies set by responses in jar and sends them with
+// the later requests they match, redirects included. The jar merges with the
+// cookies of AddCookie and WithReqCookie: those are sent first, followed by
+// the matching jar cookies, even when a name appears twice.
+func WithCookieJar(jar http.CookieJar) ClientOption {
+	return func(client *Client) {
+		client.ownHTTP().Jar = jar
+	}
+}
+
+// WithDefaultCookieJar is WithCookieJar with an in-memory jar that follows
+// the public suffix list, so a site cannot set cookies for e.g. co.uk.
+func WithDefaultCookieJar() ClientOption {
+	return func(client *Client) {
+		jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+		if err != nil {
+			client.invalidOption("WithDefaultCookieJar", "%v", err)
+			return
+		}
+		client.ownHTTP().Jar = jar
+	}
+}
@@ -0,0 +1,56 @@
+package jhttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCookieJar(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "s1", Path: "/"})
+			http.SetCookie(w, &http.Cookie{Name: "short", Value: "gone", Path: "/", Expires: time.Now().Add(-time.Hour)})
+		case "/logout":
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "", Path: "/", MaxAge: -1})
+		}
+		var cookies []string
+		for _, cookie := range r.Cookies() {
+			cookies = append(cookies, cookie.Name+"="+cookie.Value)
+		}
+		_, _ = w.Write([]byte(strings.Join(cookies, ";")))
+	}))
+	defer server.Close()
+
+	client := NewClient(WithDefaultCookieJar())
+	_, err := client.Post(server.URL+"/login", nil)
+	require.Nil(t, err)
+	resp, err := client.Get(server.URL+"/profile", nil)
+	require.Nil(t, err)
+	require.Equal(t, "session=s1", resp.String())
+
+	// the manual cookies are sent first
+	client.AddCookie([]*http.Cookie{{Name: "lang", Value: "en"}})
+	resp, err = client.Get(server.URL+"/profile", nil, WithReqCookie(&http.Cookie{Name: "session", Value: "manual"}))
+	require.Nil(t, err)
+	require.Equal(t, "lang=en;session=manual;session=s1", resp.String())
+
+	_, err = client.Get(server.URL+"/logout", nil)
+	require.Nil(t, err)
+	resp, err = client.Get(server.URL+"/profile", nil)
+	require.Nil(t, err)
+	require.Equal(t, "lang=en", resp.String())
+
+	// without a jar nothing is kept
+	client = NewClient()
+	_, err = client.Post(server.URL+"/login", nil)
+	require.Nil(t, err)
+	resp, err = client.Get(server.URL+"/profile", nil)
+	require.Nil(t, err)
+	require.Equal(t, "", resp.String())
+}
@@ -61,3 +61,17 @@ func WithJsonParams(data map[string]any) JsonOption {
 		jsonStruct.jsonMp = data
 	}
 }
+
+// WithJSONCodec encodes JSON request bodies with marshal and decodes JSON
+// responses with unmarshal, e.g. with json-iterator, instead of encoding/json.
+// Result.JSON, Map, Slice, the path getters and WithErrorDecoder use
+// unmarshal, Result.Get and NewJsonParams do not.
+func WithJSONCodec(marshal func(v any) ([]byte, error), unmarshal func(data []byte, v any) error) ClientOption {
+	return func(client *Client) {
+		if marshal == nil || unmarshal == nil {
+			client.invalidOption("WithJSONCodec", "nil marshal or unmarshal")
+			return
+		}
+		client.jsonMarshal, client.jsonUnmarshal = marshal, unmarshal
+	}
+}
@@ -0,0 +1,103 @@
+package jhttp
+
+import "strings"
+
+// link.go is used to parse RFC 5988 Link headers, e.g. for pagination
+
+// Links returns the Link header targets by relation type, e.g.
+// `<https://api/items?page=3>; rel="next"` gives {"next": "https://api/items?page=3"}.
+// Malformed links are skipped, the first link of a relation wins.
+func (result *Result) Links() map[string]string {
+	links := make(map[string]string)
+	for _, value := range result.HeaderValues("Link") {
+		for _, segment := range splitLinks(value) {
+			target, rels, ok := parseLink(segment)
+			if !ok {
+				continue
+			}
+			for _, rel := range rels {
+				if _, ok := links[rel]; !ok {
+					links[rel] = target
+				}
+			}
+		}
+	}
+	return links
+}
+
+// NextPage returns the target of the "next" link.
+func (result *Result) NextPage() (string, bool) {
+	next, ok := result.Links()["next"]
+	return next, ok
+}
+
+// splitLinks splits a Link header value on the commas outside of <> and quotes.
+func splitLinks(value string) []string {
+	var segments []string
+	var inURL, inQuote bool
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; {
+		case inQuote:
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				inQuote = false
+			}
+		case inURL:
+			if c == '>' {
+				inURL = false
+			}
+		case c == '<':
+			inURL = true
+		case c == '"':
+			inQuote = true
+		case c == ',':
+			segments = append(segments, value[start:i])
+			start = i + 1
+		}
+	}
+	return append(segments, value[start:])
+}
+
+// parseLink parses `<target>; param=value; ...` and returns the target and
+// its lowercased relation types.
+func parseLink(segment string) (string, []string, bool) {
+	segment = strings.TrimSpace(segment)
+	if !strings.HasPrefix(segment, "<") {
+		return "", nil, false
+	}
+	end := strings.IndexByte(segment, '>')
+	if end < 0 {
+		return "", nil, false
+	}
+	target := strings.TrimSpace(segment[1:end])
+	var rels []string
+	for _, param := range strings.Split(segment[end+1:], ";") {
+		key, value, ok := cutParam(param)
+		if !ok || key != "rel" {
+			continue
+		}
+		for _, rel := range strings.Fields(value) {
+			rels = append(rels, strings.ToLower(rel))
+		}
+		break
+	}
+	if len(rels) == 0 {
+		return "", nil, false
+	}
+	return target, rels, true
+}
+
+func cutParam(param string) (string, string, bool) {
+	i := strings.IndexByte(param, '=')
+	if i < 0 {
+		return "", "", false
+	}
+	key := strings.ToLower(strings.TrimSpace(param[:i]))
+	value := strings.TrimSpace(param[i+1:])
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		value = strings.ReplaceAll(value[1:len(value)-1], `\"`, `"`)
+	}
+	return key, value, key != ""
+}
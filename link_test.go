@@ -0,0 +1,77 @@
+package jhttp
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResultLinks(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []string
+		want   map[string]string
+	}{
+		{
+			name:   "github",
+			header: []string{`<https://api.github.com/repos?page=3>; rel="next", <https://api.github.com/repos?page=10>; rel="last"`},
+			want: map[string]string{
+				"next": "https://api.github.com/repos?page=3",
+				"last": "https://api.github.com/repos?page=10",
+			},
+		},
+		{
+			name:   "unquoted rel and extra params",
+			header: []string{`<https://api/items?page=2>; title="a, b; c"; rel=next; type="application/json"`},
+			want:   map[string]string{"next": "https://api/items?page=2"},
+		},
+		{
+			name:   "multiple headers",
+			header: []string{`<https://api/items?page=1>; rel="prev"`, `<https://api/items?page=3>; rel="next"`},
+			want: map[string]string{
+				"prev": "https://api/items?page=1",
+				"next": "https://api/items?page=3",
+			},
+		},
+		{
+			name:   "multiple rels and case",
+			header: []string{`<https://api/items?page=9>; REL="Next Last"`},
+			want: map[string]string{
+				"next": "https://api/items?page=9",
+				"last": "https://api/items?page=9",
+			},
+		},
+		{
+			name:   "comma in url",
+			header: []string{`<https://api/items?ids=1,2,3&page=2>; rel="next"`},
+			want:   map[string]string{"next": "https://api/items?ids=1,2,3&page=2"},
+		},
+		{
+			name:   "malformed segments skipped",
+			header: []string{`https://api/bare; rel="first", <https://api/broken; rel="prev", <https://api/norel>; type="x", <https://api/ok>; rel="next",`},
+			want:   map[string]string{"next": "https://api/ok"},
+		},
+		{
+			name: "empty",
+			want: map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := NewResult(&http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Link": tt.header},
+				Body:       io.NopCloser(strings.NewReader("")),
+			})
+			require.Nil(t, err)
+			require.Equal(t, tt.want, result.Links())
+			next, ok := result.NextPage()
+			require.Equal(t, tt.want["next"], next)
+			_, want := tt.want["next"]
+			require.Equal(t, want, ok)
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package jhttp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// middleware.go is used to change or reject requests right before they are
+// sent, and responses right after they arrived
+
+// WithRequestMiddleware calls middleware with every attempt right before it
+// is sent, after the headers, auth and cookies were set, e.g. to stamp a trace
+// id. It can be given more than once, the middlewares run in the order they
+// were added. An error aborts the request, it is not retried.
+func WithRequestMiddleware(middleware func(req *http.Request) error) ClientOption {
+	return func(client *Client) {
+		if middleware == nil {
+			client.invalidOption("WithRequestMiddleware", "nil middleware")
+			return
+		}
+		client.middlewares = append(client.middlewares, middleware)
+	}
+}
+
+// WithResponseMiddleware calls middleware with the response of every attempt
+// before it becomes a Result or a StatusError, after the body was
+// decompressed, e.g. to verify a signature header. It can be given more than
+// once, the middlewares run in the order they were added. An error fails the
+// attempt, which is then retried like any other failure. A middleware that
+// reads the body must leave an unread one in its place, see PeekBody.
+func WithResponseMiddleware(middleware func(resp *http.Response) error) ClientOption {
+	return func(client *Client) {
+		if middleware == nil {
+			client.invalidOption("WithResponseMiddleware", "nil middleware")
+			return
+		}
+		client.responseMiddlewares = append(client.responseMiddlewares, middleware)
+	}
+}
+
+// PeekBody returns up to n bytes of the body of resp without consuming them,
+// the body still reads from the start afterwards.
+func PeekBody(resp *http.Response, n int64) ([]byte, error) {
+	if resp.Body == nil || resp.Body == http.NoBody {
+		return nil, nil
+	}
+	peeked, err := io.ReadAll(io.LimitReader(resp.Body, n))
+	resp.Body = &peekedBody{Reader: io.MultiReader(bytes.NewReader(peeked), resp.Body), Closer: resp.Body}
+	return peeked, err
+}
+
+type peekedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// WithRoundTripperMiddleware wraps the transport of the client with mw, e.g.
+// existing tracing or auth RoundTripper wrappers. The first middleware is the
+// outermost one, it sees a request first and its response last. The
+// transport configured by all options is wrapped, whatever the order of
+// WithTransport and this option. It can be given more than once.
+func WithRoundTripperMiddleware(mw ...func(http.RoundTripper) http.RoundTripper) ClientOption {
+	return func(client *Client) {
+		for _, m := range mw {
+			if m == nil {
+				client.invalidOption("WithRoundTripperMiddleware", "nil middleware")
+				return
+			}
+		}
+		client.roundTripperMiddlewares = append(client.roundTripperMiddlewares, mw...)
+	}
+}
+
+// buildRoundTripper wraps the transport of the client once all its options
+// were applied.
+func (c *Client) buildRoundTripper() {
+	c.roundTripper = nil
+	if len(c.roundTripperMiddlewares) == 0 {
+		return
+	}
+	var rt http.RoundTripper = http.DefaultTransport
+	if c.http != nil && c.http.Transport != nil {
+		rt = c.http.Transport
+	}
+	c.roundTripper = c.wrapRoundTripper(rt)
+}
+
+// wrapRoundTripper wraps rt with the round tripper middlewares.
+func (c *Client) wrapRoundTripper(rt http.RoundTripper) http.RoundTripper {
+	for i := len(c.roundTripperMiddlewares) - 1; i >= 0; i-- {
+		rt = c.roundTripperMiddlewares[i](rt)
+	}
+	return rt
+}
+
+// middlewareError is returned by a rejecting middleware, it unwraps to the
+// error of the middleware.
+type middlewareError struct {
+	err error
+}
+
+func (e *middlewareError) Error() string {
+	return fmt.Sprintf("request middleware: %v", e.err)
+}
+
+func (e *middlewareError) Unwrap() error {
+	return e.err
+}
+
+// rejectedByMiddleware reports whether err is the rejection of a middleware,
+// the request was then never sent.
+func rejectedByMiddleware(err error) bool {
+	var middlewareErr *middlewareError
+	return errors.As(err, &middlewareErr)
+}
+
+// applyResponseMiddlewares runs the response middlewares of the client on
+// resp, the body is closed when one fails.
+func (c *Client) applyResponseMiddlewares(resp *http.Response) error {
+	for _, middleware := range c.responseMiddlewares {
+		if err := middleware(resp); err != nil {
+			_ = resp.Body.Close()
+			return fmt.Errorf("response middleware: %w", err)
+		}
+	}
+	return nil
+}
+
+// applyMiddlewares runs the middlewares of the client on req.
+func (c *Client) applyMiddlewares(req *http.Request) error {
+	for _, middleware := range c.middlewares {
+		if err := middleware(req); err != nil {
+			return &middlewareError{err: err}
+		}
+	}
+	return nil
+}
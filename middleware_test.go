@@ -0,0 +1,212 @@
+package jhttp
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestMiddleware(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/flaky" && atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(strings.Join(r.Header.Values("X-Order"), ",") + " " + r.Header.Get("X-Attempt")))
+	}))
+	defer server.Close()
+
+	var attempts int32
+	client := NewClient(
+		AddHeader("X-Tenant", "t1"),
+		SetRetry(1), WithRetryWait(0, 0),
+		WithRequestMiddleware(func(req *http.Request) error {
+			// the client headers are already set
+			req.Header.Add("X-Order", "first:"+req.Header.Get("X-Tenant"))
+			return nil
+		}),
+		WithRequestMiddleware(func(req *http.Request) error {
+			req.Header.Add("X-Order", "second")
+			req.Header.Set("X-Attempt", strconv.Itoa(int(atomic.AddInt32(&attempts, 1))))
+			return nil
+		}),
+	)
+	resp, err := client.Get(server.URL, nil)
+	require.Nil(t, err)
+	require.Equal(t, "first:t1,second 1", resp.String())
+
+	// every attempt runs the middlewares on a fresh request
+	resp, err = client.Get(server.URL+"/flaky", nil)
+	require.Nil(t, err)
+	require.Equal(t, 2, resp.Attempts())
+	require.Equal(t, "first:t1,second 3", resp.String())
+
+	// a rejecting middleware aborts the request and is not retried
+	errNotAllowed := errors.New("host not allowed")
+	var calls int32
+	atomic.StoreInt32(&requests, 0)
+	allowlist := client.Clone(WithRequestMiddleware(func(req *http.Request) error {
+		atomic.AddInt32(&calls, 1)
+		if req.URL.Host != "api.example.com" {
+			return errNotAllowed
+		}
+		return nil
+	}))
+	_, err = allowlist.Post(server.URL+"/flaky", "body", WithReqRetryable(true))
+	require.Equal(t, true, errors.Is(err, errNotAllowed))
+	require.Contains(t, err.Error(), "request middleware: host not allowed")
+	require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	require.Equal(t, int32(0), atomic.LoadInt32(&requests))
+
+	// the clone did not add its middleware to the client
+	_, err = client.Get(server.URL, nil)
+	require.Nil(t, err)
+
+	require.ErrorContains(t, NewClient(WithRequestMiddleware(nil)).Validate(), "WithRequestMiddleware: nil middleware")
+}
+
+func TestResponseMiddleware(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+		signature := "valid"
+		if r.URL.Path == "/flaky" && n == 1 {
+			signature = "forged"
+		}
+		w.Header().Set("X-Signature", signature)
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		_, _ = w.Write([]byte(`{"data":"` + strings.Repeat("x", 100) + `"}`))
+	}))
+	defer server.Close()
+
+	var order []string
+	var peeked string
+	errForged := errors.New("invalid signature")
+	client := NewClient(
+		SetRetry(1), WithRetryWait(0, 0),
+		WithResponseMiddleware(func(resp *http.Response) error {
+			order = append(order, "verify")
+			if resp.Header.Get("X-Signature") != "valid" {
+				return errForged
+			}
+			return nil
+		}),
+		WithResponseMiddleware(func(resp *http.Response) error {
+			order = append(order, "peek")
+			body, err := PeekBody(resp, 9)
+			peeked = string(body)
+			return err
+		}),
+	)
+	resp, err := client.Get(server.URL, nil)
+	require.Nil(t, err)
+	require.Equal(t, []string{"verify", "peek"}, order)
+	require.Equal(t, `{"data":"`, peeked)
+	// the peeked bytes are still part of the body
+	require.Equal(t, `{"data":"`+strings.Repeat("x", 100)+`"}`, resp.String())
+
+	// a failing middleware fails the attempt, which is retried
+	order = nil
+	atomic.StoreInt32(&requests, 0)
+	resp, err = client.Get(server.URL+"/flaky", nil)
+	require.Nil(t, err)
+	require.Equal(t, 2, resp.Attempts())
+	require.Equal(t, []string{"verify", "verify", "peek"}, order)
+
+	atomic.StoreInt32(&requests, 0)
+	_, err = client.Clone(SetRetry(0)).Get(server.URL+"/flaky", nil)
+	require.Equal(t, true, errors.Is(err, errForged))
+	require.Contains(t, err.Error(), "response middleware: invalid signature")
+
+	// error responses keep their body too
+	_, err = client.Get(server.URL+"/missing", nil)
+	var se *StatusError
+	require.Equal(t, true, errors.As(err, &se))
+	require.Equal(t, `{"data":"`+strings.Repeat("x", 100)+`"}`, string(se.Body))
+
+	// a streamed body is peeked the same way
+	resp, err = client.Get(server.URL, nil, WithStreamBody())
+	require.Nil(t, err)
+	body, err := io.ReadAll(resp.Reader())
+	require.Nil(t, err)
+	require.Nil(t, resp.Close())
+	require.Equal(t, `{"data":"`+strings.Repeat("x", 100)+`"}`, string(body))
+
+	require.ErrorContains(t, NewClient(WithResponseMiddleware(nil)).Validate(), "WithResponseMiddleware: nil middleware")
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestRoundTripperMiddleware(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strings.Join(r.Header.Values("X-Layers"), ",") + " " + r.Header.Get("X-Transport")))
+	}))
+	defer server.Close()
+
+	var order []string
+	var counted int32
+	counting := func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			atomic.AddInt32(&counted, 1)
+			order = append(order, "count")
+			req.Header.Add("X-Layers", "count")
+			resp, err := next.RoundTrip(req)
+			order = append(order, "count done")
+			return resp, err
+		})
+	}
+	header := func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			order = append(order, "header")
+			req.Header.Add("X-Layers", "header")
+			resp, err := next.RoundTrip(req)
+			order = append(order, "header done")
+			return resp, err
+		})
+	}
+	// a transport given before or after the middlewares is wrapped
+	stub := func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			req.Header.Set("X-Transport", "custom")
+			return next.RoundTrip(req)
+		})
+	}(http.DefaultTransport)
+
+	clients := map[string]*Client{
+		"default":          NewClient(WithRoundTripperMiddleware(counting, header)),
+		"separate options": NewClient(WithRoundTripperMiddleware(counting), WithMaxIdleConnsPerHost(4), WithRoundTripperMiddleware(header)),
+		"transport before": NewClient(WithTransport(stub), WithRoundTripperMiddleware(counting, header)),
+		"transport after":  NewClient(WithRoundTripperMiddleware(counting, header), WithTransport(stub)),
+		"clone":            NewClient(WithRoundTripperMiddleware(counting)).Clone(WithRoundTripperMiddleware(header)),
+		"clone transport":  NewClient(WithRoundTripperMiddleware(counting, header)).Clone(WithTransport(stub)),
+	}
+	for name, client := range clients {
+		order = nil
+		atomic.StoreInt32(&counted, 0)
+		resp, err := client.Get(server.URL, nil)
+		require.Nil(t, err, name)
+		want := "count,header "
+		if strings.Contains(name, "transport") {
+			want += "custom"
+		}
+		require.Equal(t, want, resp.String(), name)
+		require.Equal(t, []string{"count", "header", "header done", "count done"}, order, name)
+		require.Equal(t, int32(1), atomic.LoadInt32(&counted), name)
+	}
+
+	require.ErrorContains(t, NewClient(WithRoundTripperMiddleware(nil)).Validate(), "WithRoundTripperMiddleware: nil middleware")
+}
@@ -0,0 +1,149 @@
+package jhttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// path.go is used to extract single values from JSON bodies by path. A path
+// is a list of object keys and array indices separated by dots, for example
+// "data.items.0.id". Use Result.Get for the full gjson syntax.
+
+var (
+	ErrPathNotFound = errors.New("path not found")
+	ErrPathType     = errors.New("unexpected value type")
+)
+
+// PathError records the path that failed and why, it wraps ErrPathNotFound,
+// ErrPathType or a *strconv.NumError for numbers that overflow.
+type PathError struct {
+	Path string
+	Err  error
+}
+
+func (e *PathError) Error() string {
+	return "json path " + e.Path + ": " + e.Err.Error()
+}
+
+func (e *PathError) Unwrap() error {
+	return e.Err
+}
+
+// GetString returns the string at path.
+func (result *Result) GetString(path string) (string, error) {
+	v, err := result.lookup(path)
+	if err != nil {
+		return "", err
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", &PathError{Path: path, Err: ErrPathType}
+	}
+	return s, nil
+}
+
+// GetInt returns the integer at path, numbers with a fraction are a type
+// mismatch.
+func (result *Result) GetInt(path string) (int, error) {
+	v, err := result.lookup(path)
+	if err != nil {
+		return 0, err
+	}
+	num, ok := toNumber(v)
+	if !ok || strings.ContainsAny(num.String(), ".eE") {
+		return 0, &PathError{Path: path, Err: ErrPathType}
+	}
+	i, err := strconv.ParseInt(num.String(), 10, strconv.IntSize)
+	if err != nil {
+		return 0, &PathError{Path: path, Err: err}
+	}
+	return int(i), nil
+}
+
+// GetFloat returns the number at path.
+func (result *Result) GetFloat(path string) (float64, error) {
+	v, err := result.lookup(path)
+	if err != nil {
+		return 0, err
+	}
+	num, ok := toNumber(v)
+	if !ok {
+		return 0, &PathError{Path: path, Err: ErrPathType}
+	}
+	f, err := num.Float64()
+	if err != nil {
+		return 0, &PathError{Path: path, Err: err}
+	}
+	return f, nil
+}
+
+// GetBool returns the boolean at path.
+func (result *Result) GetBool(path string) (bool, error) {
+	v, err := result.lookup(path)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, &PathError{Path: path, Err: ErrPathType}
+	}
+	return b, nil
+}
+
+// toNumber returns a number decoded with UseNumber, or as a float64 by a
+// codec of WithJSONCodec.
+func toNumber(v any) (json.Number, bool) {
+	switch num := v.(type) {
+	case json.Number:
+		return num, true
+	case float64:
+		return json.Number(strconv.FormatFloat(num, 'f', -1, 64)), true
+	}
+	return "", false
+}
+
+// lookup walks the body parsed once with exact numbers, a null value is
+// returned as nil and is a type mismatch for every getter.
+func (result *Result) lookup(path string) (any, error) {
+	result.treeOnce.Do(func() {
+		body, err := result.Body()
+		if err != nil {
+			result.treeErr = err
+			return
+		}
+		// a codec of WithJSONCodec decides itself how numbers are decoded
+		if result.unmarshal != nil {
+			result.treeErr = result.unmarshal(body, &result.tree)
+			return
+		}
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		result.treeErr = decoder.Decode(&result.tree)
+	})
+	if result.treeErr != nil {
+		return nil, result.treeErr
+	}
+	v := result.tree
+	for _, key := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]any:
+			child, ok := node[key]
+			if !ok {
+				return nil, &PathError{Path: path, Err: ErrPathNotFound}
+			}
+			v = child
+		case []any:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, &PathError{Path: path, Err: ErrPathNotFound}
+			}
+			v = node[index]
+		default:
+			return nil, &PathError{Path: path, Err: ErrPathNotFound}
+		}
+	}
+	return v, nil
+}
@@ -0,0 +1,58 @@
+package jhttp
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResultGetPath(t *testing.T) {
+	result := newTestResult(t, `{
+		"data": {
+			"items": [{"id": "a1", "count": 3, "price": 1.5, "active": true, "note": null}],
+			"total": 9223372036854775807,
+			"huge": 9223372036854775808
+		}
+	}`)
+
+	id, err := result.GetString("data.items.0.id")
+	require.Nil(t, err)
+	require.Equal(t, "a1", id)
+	count, err := result.GetInt("data.items.0.count")
+	require.Nil(t, err)
+	require.Equal(t, 3, count)
+	price, err := result.GetFloat("data.items.0.price")
+	require.Nil(t, err)
+	require.Equal(t, 1.5, price)
+	active, err := result.GetBool("data.items.0.active")
+	require.Nil(t, err)
+	require.Equal(t, true, active)
+	total, err := result.GetInt("data.total")
+	require.Nil(t, err)
+	require.Equal(t, 9223372036854775807, total)
+
+	for _, path := range []string{"data.missing", "data.items.1.id", "data.items.x", "data.items.0.id.deeper"} {
+		_, err = result.GetString(path)
+		require.Equal(t, true, errors.Is(err, ErrPathNotFound), path)
+	}
+
+	_, err = result.GetInt("data.items.0.id")
+	require.Equal(t, true, errors.Is(err, ErrPathType))
+	_, err = result.GetInt("data.items.0.price")
+	require.Equal(t, true, errors.Is(err, ErrPathType))
+	_, err = result.GetBool("data.items")
+	require.Equal(t, true, errors.Is(err, ErrPathType))
+	_, err = result.GetString("data.items.0.note")
+	require.Equal(t, true, errors.Is(err, ErrPathType))
+
+	_, err = result.GetInt("data.huge")
+	require.Equal(t, true, errors.Is(err, strconv.ErrRange))
+	var pathErr *PathError
+	require.Equal(t, true, errors.As(err, &pathErr))
+	require.Equal(t, "data.huge", pathErr.Path)
+
+	_, err = newTestResult(t, `{"data":`).GetString("data")
+	require.NotNil(t, err)
+}
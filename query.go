@@ -0,0 +1,119 @@
+package jhttp
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// query.go is used to encode tagged structs into query parameters
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// AddParamsStruct adds the exported fields of a struct as query parameters.
+// Fields are named by the `query` tag, `query:"-"` skips a field and
+// `query:"name,omitempty"` skips zero values. Slices add one parameter per
+// element and time.Time is formatted as RFC3339.
+func AddParamsStruct(v any) ParamsOption {
+	return func(r *request) {
+		if err := encodeQueryStruct(r.query, reflect.ValueOf(v)); err != nil && r.err == nil {
+			r.err = err
+		}
+	}
+}
+
+func encodeQueryStruct(values url.Values, rv reflect.Value) error {
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("query params: expected a struct, got %s", rv.Kind())
+	}
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag := field.Tag.Get("query")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		fv := rv.Field(i)
+		if field.Anonymous && tag == "" && indirectType(field.Type).Kind() == reflect.Struct && indirectType(field.Type) != timeType {
+			if err := encodeQueryStruct(values, fv); err != nil {
+				return err
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if opts == "omitempty" && fv.IsZero() {
+			continue
+		}
+		if err := encodeQueryValue(values, name, fv); err != nil {
+			return fmt.Errorf("query params: field %s: %w", field.Name, err)
+		}
+	}
+	return nil
+}
+
+func encodeQueryValue(values url.Values, name string, fv reflect.Value) error {
+	for fv.Kind() == reflect.Pointer || fv.Kind() == reflect.Interface {
+		if fv.IsNil() {
+			return nil
+		}
+		fv = fv.Elem()
+	}
+	if fv.Kind() == reflect.Slice || fv.Kind() == reflect.Array {
+		for i := 0; i < fv.Len(); i++ {
+			if err := encodeQueryValue(values, name, fv.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	str, err := formatQueryValue(fv)
+	if err != nil {
+		return err
+	}
+	values.Add(name, str)
+	return nil
+}
+
+func formatQueryValue(fv reflect.Value) (string, error) {
+	if fv.Type() == timeType {
+		return fv.Interface().(time.Time).Format(time.RFC3339), nil
+	}
+	switch fv.Kind() {
+	case reflect.String:
+		return fv.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(fv.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(fv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(fv.Uint(), 10), nil
+	case reflect.Float32:
+		return strconv.FormatFloat(fv.Float(), 'f', -1, 32), nil
+	case reflect.Float64:
+		return strconv.FormatFloat(fv.Float(), 'f', -1, 64), nil
+	default:
+		return "", fmt.Errorf("unsupported kind %s", fv.Kind())
+	}
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
@@ -0,0 +1,69 @@
+package jhttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type Paging struct {
+	Page int `query:"page"`
+}
+
+type ListOpts struct {
+	Paging
+	Ids     []string  `query:"id"`
+	Active  bool      `query:"active"`
+	Score   float64   `query:"score,omitempty"`
+	Limit   *int      `query:"limit"`
+	Since   time.Time `query:"since"`
+	Name    string    `query:"name,omitempty"`
+	Ignored string    `query:"-"`
+	hidden  string
+}
+
+func TestAddParamsStruct(t *testing.T) {
+	limit := 20
+	opts := ListOpts{
+		Paging: Paging{Page: 2},
+		Ids:    []string{"1", "2"},
+		Active: true,
+		Limit:  &limit,
+		Since:  time.Date(2022, 10, 1, 8, 0, 0, 0, time.UTC),
+		hidden: "hidden",
+	}
+	r := newRequest("GET", "https://example.com/list", nil, AddParamsStruct(opts))
+	require.Nil(t, r.err)
+	require.Equal(t, "https://example.com/list?active=true&id=1&id=2&limit=20&page=2&since=2022-10-01T08%3A00%3A00Z", r.buildURL())
+
+	opts.Score = 1.5
+	opts.Name = "a b"
+	opts.Limit = nil
+	r = newRequest("GET", "https://example.com/list", nil, AddParamsStruct(&opts))
+	require.Nil(t, r.err)
+	require.Equal(t, "https://example.com/list?active=true&id=1&id=2&name=a+b&page=2&score=1.5&since=2022-10-01T08%3A00%3A00Z", r.buildURL())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.RawQuery))
+	}))
+	defer server.Close()
+	client := NewClient()
+
+	resp, err := client.Get(server.URL, nil, AddParamsStruct(struct {
+		Page int `query:"page"`
+	}{Page: 3}))
+	require.Nil(t, err)
+	require.Equal(t, true, resp.Equal("page=3"))
+
+	_, err = client.Get(server.URL, nil, AddParamsStruct(struct {
+		Extra map[string]string `query:"extra"`
+	}{Extra: map[string]string{"k": "v"}}))
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "field Extra: unsupported kind map")
+
+	_, err = client.Get(server.URL, nil, AddParamsStruct("page=1"))
+	require.NotNil(t, err)
+}
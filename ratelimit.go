@@ -0,0 +1,103 @@
+package jhttp
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ratelimit.go is used to pace the requests of a client
+
+// WithRateLimit sends at most rps attempts per second on average, with bursts
+// of up to burst attempts. Every attempt takes a token, retries and hedged
+// copies included, and waits for one when there is none left. The wait ends
+// with the attempt context, the token is then given back. A Clone shares the
+// limit unless it sets its own.
+func WithRateLimit(rps float64, burst int) ClientOption {
+	return func(client *Client) {
+		if rps <= 0 || burst < 1 {
+			client.invalidOption("WithRateLimit", "invalid rate %g or burst %d", rps, burst)
+			return
+		}
+		client.rateLimiter = &rateLimiter{rate: rps, burst: float64(burst), tokens: float64(burst)}
+	}
+}
+
+// rateLimiter is a token bucket, tokens may become negative for the attempts
+// that wait for one.
+type rateLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	tokens  float64
+	last    time.Time
+	waiting int64
+}
+
+// advance adds the tokens earned since the last call.
+func (l *rateLimiter) advance(now time.Time) {
+	if !l.last.IsZero() && now.After(l.last) {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	if now.After(l.last) {
+		l.last = now
+	}
+}
+
+// reserve takes a token and returns how long to wait until it is earned.
+func (l *rateLimiter) reserve(now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.advance(now)
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	l.waiting++
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// done ends a wait, the token is given back if it was not used.
+func (l *rateLimiter) done(used bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.waiting--
+	if !used {
+		l.tokens++
+	}
+}
+
+// state returns the tokens available at now and the attempts waiting.
+func (l *rateLimiter) state(now time.Time) (float64, int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.advance(now)
+	tokens := l.tokens
+	if tokens < 0 {
+		tokens = 0
+	}
+	return tokens, l.waiting
+}
+
+// waitRateLimit waits for a token of the rate limit, if any.
+func (c *Client) waitRateLimit(ctx context.Context) error {
+	if c.rateLimiter == nil {
+		return nil
+	}
+	wait := c.rateLimiter.reserve(c.clock())
+	if wait == 0 {
+		return nil
+	}
+	atomic.AddInt64(&c.counters().rateLimitWaits, 1)
+	err := c.sleepFor(ctx, wait)
+	c.rateLimiter.done(err == nil)
+	if err != nil {
+		return fmt.Errorf("wait for rate limit: %w", wrapTransportError(err))
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package jhttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock is a clock that only moves when the client sleeps.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (f *fakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *fakeClock) Sleep(_ context.Context, d time.Duration) error {
+	f.mu.Lock()
+	f.now = f.now.Add(d)
+	f.mu.Unlock()
+	return nil
+}
+
+func TestRateLimit(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	var mu sync.Mutex
+	var sent []time.Duration
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		sent = append(sent, clock.Now().Sub(time.Unix(0, 0)))
+		mu.Unlock()
+		if r.URL.Path == "/flaky" && atomic.AddInt32(&requests, 1)%2 == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name  string
+		burst int
+		want  func(i int) time.Duration
+	}{
+		{name: "no burst", burst: 1, want: func(i int) time.Duration {
+			return time.Duration(i) * 100 * time.Millisecond
+		}},
+		{name: "burst", burst: 5, want: func(i int) time.Duration {
+			if i < 5 {
+				return 0
+			}
+			return time.Duration(i-4) * 100 * time.Millisecond
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock.now = time.Unix(0, 0)
+			sent = nil
+			client := NewClient(WithRateLimit(10, tt.burst))
+			client.now, client.sleep = clock.Now, clock.Sleep
+			for i := 0; i < 25; i++ {
+				_, err := client.Get(server.URL, nil)
+				require.Nil(t, err)
+			}
+			require.Len(t, sent, 25)
+			for i, at := range sent {
+				require.Equal(t, tt.want(i), at, "request %d", i)
+			}
+			stats := client.Stats()
+			require.Equal(t, int64(25-tt.burst), stats.RateLimitWaits)
+			require.Equal(t, int64(0), stats.RateLimitWaiting)
+			require.Equal(t, float64(0), stats.RateLimitTokens)
+			clock.now = clock.now.Add(time.Second)
+			require.Equal(t, float64(tt.burst), client.Stats().RateLimitTokens)
+		})
+	}
+
+	// every retried attempt takes a token
+	clock.now = time.Unix(0, 0)
+	sent = nil
+	client := NewClient(WithRateLimit(10, 1), SetRetry(1), WithRetryWait(0, 0))
+	client.now, client.sleep = clock.Now, clock.Sleep
+	for i := 0; i < 3; i++ {
+		_, err := client.Get(server.URL+"/flaky", nil)
+		require.Nil(t, err)
+	}
+	require.Len(t, sent, 6)
+	for i, at := range sent {
+		require.Equal(t, time.Duration(i)*100*time.Millisecond, at, "attempt %d", i)
+	}
+	require.Equal(t, int64(5), client.Stats().RateLimitWaits)
+}
+
+func TestRateLimitContext(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+	}))
+	defer server.Close()
+
+	client := NewClient(WithRateLimit(0.1, 1))
+	_, err := client.Get(server.URL, nil)
+	require.Nil(t, err)
+
+	// a caller does not wait for a token past its deadline
+	start := time.Now()
+	_, err = client.Get(server.URL, nil, WithRequestTimeout(50*time.Millisecond))
+	require.Equal(t, true, errors.Is(err, ErrTimeout))
+	require.Contains(t, err.Error(), "wait for rate limit")
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_, err = client.Get(server.URL, nil, WithRequestContext(ctx))
+	require.Equal(t, true, errors.Is(err, context.Canceled))
+	require.Less(t, time.Since(start), time.Second)
+	require.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	// the tokens of the abandoned waits were given back
+	stats := client.Stats()
+	require.Equal(t, int64(2), stats.RateLimitWaits)
+	require.Equal(t, int64(0), stats.RateLimitWaiting)
+	require.Less(t, stats.RateLimitTokens, 0.1)
+
+	err = NewClient(WithRateLimit(0, 1)).Validate()
+	require.ErrorContains(t, err, "WithRateLimit: invalid rate 0 or burst 1")
+}
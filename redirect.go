@@ -0,0 +1,65 @@
+package jhttp
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// redirect.go is used to control how redirects are followed
+
+// WithNoRedirects stops following redirects, 3xx responses are returned as a
+// Result, e.g. to hand the Location to a browser.
+func WithNoRedirects() ClientOption {
+	return func(client *Client) {
+		client.noRedirects = true
+		client.ownHTTP().CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+}
+
+// WithMaxRedirects follows at most n redirects, more fail with
+// ErrTooManyRedirects.
+func WithMaxRedirects(n int) ClientOption {
+	return func(client *Client) {
+		if n < 0 {
+			client.invalidOption("WithMaxRedirects", "negative redirect count %d", n)
+		}
+		client.noRedirects = false
+		client.ownHTTP().CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			if len(via) > n {
+				return fmt.Errorf("stopped after %d redirects: %w", n, ErrTooManyRedirects)
+			}
+			return nil
+		}
+	}
+}
+
+// WithRedirectPolicy sets the CheckRedirect policy of the http.Client, see
+// http.Client for its contract.
+func WithRedirectPolicy(policy func(req *http.Request, via []*http.Request) error) ClientOption {
+	return func(client *Client) {
+		client.noRedirects = false
+		client.ownHTTP().CheckRedirect = policy
+	}
+}
+
+// Redirects returns the URLs that redirected the request in the order they
+// were visited, the final URL is returned by URL.
+func (result *Result) Redirects() []string {
+	return result.redirects
+}
+
+// redirectChain walks back from the final request through the responses that
+// redirected to it.
+func redirectChain(req *http.Request) []string {
+	var chain []string
+	for req != nil && req.Response != nil {
+		req = req.Response.Request
+		if req == nil {
+			break
+		}
+		chain = append([]string{req.URL.String()}, chain...)
+	}
+	return chain
+}
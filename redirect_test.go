@@ -0,0 +1,58 @@
+package jhttp
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedirects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a":
+			http.Redirect(w, r, "/b", http.StatusMovedPermanently)
+		case "/b":
+			http.Redirect(w, r, "/c", http.StatusFound)
+		default:
+			_, _ = w.Write([]byte("done"))
+		}
+	}))
+	defer server.Close()
+
+	resp, err := NewClient().Get(server.URL+"/a", nil)
+	require.Nil(t, err)
+	require.Equal(t, "done", resp.String())
+	require.Equal(t, server.URL+"/c", resp.URL())
+	require.Equal(t, []string{server.URL + "/a", server.URL + "/b"}, resp.Redirects())
+
+	resp, err = NewClient(WithNoRedirects()).Get(server.URL+"/a", nil)
+	require.Nil(t, err)
+	require.Equal(t, http.StatusMovedPermanently, resp.StatusCode())
+	require.Equal(t, "/b", resp.Header("Location"))
+	require.Empty(t, resp.Redirects())
+
+	_, err = NewClient(WithMaxRedirects(1)).Get(server.URL+"/a", nil)
+	require.Equal(t, true, errors.Is(err, ErrTooManyRedirects))
+	resp, err = NewClient(WithMaxRedirects(2)).Get(server.URL+"/a", nil)
+	require.Nil(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode())
+
+	errBlocked := errors.New("blocked")
+	var visited []string
+	_, err = NewClient(WithRedirectPolicy(func(req *http.Request, via []*http.Request) error {
+		visited = append(visited, req.URL.Path)
+		if req.URL.Path == "/c" {
+			return errBlocked
+		}
+		return nil
+	})).Get(server.URL+"/a", nil)
+	require.Equal(t, true, errors.Is(err, errBlocked))
+	require.Equal(t, false, errors.Is(err, ErrTooManyRedirects))
+	require.Equal(t, []string{"/b", "/c"}, visited)
+
+	// the shared client is never modified
+	require.Nil(t, http.DefaultClient.CheckRedirect)
+}
@@ -0,0 +1,197 @@
+package jhttp
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// request holds the state of a single call built from its ParamsOption
+// values, it is never shared between calls.
+type request struct {
+	method  string
+	url     string
+	data    any
+	query   url.Values
+	header  http.Header
+	ctx     context.Context
+	timeout time.Duration
+	// path parameters substituted into `{name}` placeholders
+	pathParams       map[string]string
+	idempotencyKey   string
+	cookies          []*http.Cookie
+	basicAuth        *basicAuth
+	stream           bool
+	maxResponseBytes int64
+	// retryable overrides the method based retry decision when set
+	retryable *bool
+	// hedgeDelay and hedgeExtra are set by WithHedging
+	hedgeDelay time.Duration
+	hedgeExtra int
+	// hostOverride is sent as the Host of the request
+	hostOverride string
+	// bearerToken of the current attempt, from the client token provider
+	bearerToken string
+	// err records an invalid option, it is returned before sending
+	err error
+}
+
+var pathParamRegexp = regexp.MustCompile(`\{[^{}/]*\}`)
+
+type basicAuth struct {
+	username string
+	password string
+}
+
+func newRequest(method, rawURL string, data any, opts ...ParamsOption) *request {
+	r := &request{
+		method:     method,
+		url:        rawURL,
+		data:       data,
+		query:      url.Values{},
+		header:     http.Header{},
+		pathParams: map[string]string{},
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// expandPath substitutes the path parameters into the url path, values are
+// path-escaped and any unresolved placeholder is an error.
+func (r *request) expandPath() error {
+	path, query := r.url, ""
+	if i := strings.Index(path, "?"); i >= 0 {
+		path, query = path[:i], path[i:]
+	}
+	for name, value := range r.pathParams {
+		path = strings.ReplaceAll(path, "{"+name+"}", url.PathEscape(value))
+	}
+	if placeholder := pathParamRegexp.FindString(path); placeholder != "" {
+		return fmt.Errorf("unresolved path parameter: %s", placeholder)
+	}
+	r.url = path + query
+	return nil
+}
+
+func (r *request) buildURL() string {
+	if len(r.query) == 0 {
+		return r.url
+	}
+	sep := "?"
+	if strings.HasSuffix(r.url, "?") || strings.HasSuffix(r.url, "&") {
+		sep = ""
+	} else if strings.Contains(r.url, "?") {
+		sep = "&"
+	}
+	return r.url + sep + r.query.Encode()
+}
+
+// context returns the request context, which takes precedence over the
+// client context.
+func (r *request) context(c *Client) context.Context {
+	if r.ctx != nil {
+		return r.ctx
+	}
+	if c.ctx != nil {
+		return c.ctx
+	}
+	return context.Background()
+}
+
+// attemptContext derives the context of a single attempt, every attempt gets
+// the whole request timeout.
+func (r *request) attemptContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.timeout > 0 {
+		return context.WithTimeout(ctx, r.timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// WithReqHeader sets a header for a single request, it overrides the client
+// header of the same key for that request only.
+func WithReqHeader(key, value string) ParamsOption {
+	return func(r *request) {
+		r.header.Set(key, value)
+	}
+}
+
+// WithRequestContext sets the context of a single request, it takes precedence
+// over the client context set by WithContext.
+func WithRequestContext(ctx context.Context) ParamsOption {
+	return func(r *request) {
+		r.ctx = ctx
+	}
+}
+
+// WithRequestTimeout sets the timeout of a single request, it applies to each
+// attempt separately, so a retried request may take up to (retry+1) * timeout.
+func WithRequestTimeout(timeout time.Duration) ParamsOption {
+	return func(r *request) {
+		r.timeout = timeout
+	}
+}
+
+// WithPathParam sets the value of the `{name}` placeholder in the request path.
+func WithPathParam(name, value string) ParamsOption {
+	return func(r *request) {
+		r.pathParams[name] = value
+	}
+}
+
+// WithIdempotencyKey sets the Idempotency-Key header of a single request, it
+// is reused by all retry attempts.
+func WithIdempotencyKey(key string) ParamsOption {
+	return func(r *request) {
+		r.idempotencyKey = key
+	}
+}
+
+// newIdempotencyKey returns a random (version 4) UUID.
+func newIdempotencyKey() (string, error) {
+	var uuid [16]byte
+	if _, err := rand.Read(uuid[:]); err != nil {
+		return "", err
+	}
+	uuid[6] = (uuid[6] & 0x0f) | 0x40
+	uuid[8] = (uuid[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:]), nil
+}
+
+// WithReqCookie adds a cookie to a single request, after the client cookies.
+func WithReqCookie(cookie *http.Cookie) ParamsOption {
+	return func(r *request) {
+		r.cookies = append(r.cookies, cookie)
+	}
+}
+
+// WithReqBasicAuth sets HTTP Basic auth for a single request, it overrides the
+// Authorization header of the client.
+func WithReqBasicAuth(username, password string) ParamsOption {
+	return func(r *request) {
+		r.basicAuth = &basicAuth{username: username, password: password}
+	}
+}
+
+// WithStreamBody streams the response body instead of buffering it, the body
+// is then only available through Result.Reader and must be closed by the
+// caller.
+func WithStreamBody() ParamsOption {
+	return func(r *request) {
+		r.stream = true
+	}
+}
+
+// WithReqMaxResponseBytes overrides the client WithMaxResponseBytes limit for
+// a single request.
+func WithReqMaxResponseBytes(n int64) ParamsOption {
+	return func(r *request) {
+		r.maxResponseBytes = n
+	}
+}
@@ -0,0 +1,319 @@
+package jhttp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildURL(t *testing.T) {
+	require.Equal(t, "https://example.com/api", newRequest("GET", "https://example.com/api", nil).buildURL())
+	require.Equal(t, "https://example.com/api?k1=v1", newRequest("GET", "https://example.com/api", nil, AddParams("k1", "v1")).buildURL())
+	require.Equal(t, "https://example.com/api?k1=v1&k2=v2", newRequest("GET", "https://example.com/api", nil,
+		AddParams("k2", "v2"),
+		AddParams("k1", "v1"),
+	).buildURL())
+	require.Equal(t, "https://example.com/api?a=1&k1=v1", newRequest("GET", "https://example.com/api?a=1", nil, AddParams("k1", "v1")).buildURL())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.RequestURI))
+	}))
+	defer server.Close()
+	client := NewClient()
+
+	resp, err := client.Get(server.URL+"/api", nil)
+	require.Nil(t, err)
+	require.Equal(t, true, resp.Equal("/api"))
+
+	resp, err = client.Get(server.URL+"/api", nil, AddParams("k1", "v1"), AddParams("k2", "v2"))
+	require.Nil(t, err)
+	require.Equal(t, true, resp.Equal("/api?k1=v1&k2=v2"))
+}
+
+func TestWithReqHeader(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Header.Get("Accept") + " " + r.Header.Get("X-Request-Source")))
+	}))
+	defer server.Close()
+	client := NewClient(
+		AddHeader("Accept", "application/json"),
+	)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%2 == 0 {
+				resp, err := client.Get(server.URL, nil, WithReqHeader("Accept", "application/xml"), WithReqHeader("X-Request-Source", "test"))
+				require.Nil(t, err)
+				require.Equal(t, true, resp.Equal("application/xml test"))
+				return
+			}
+			resp, err := client.Get(server.URL, nil)
+			require.Nil(t, err)
+			require.Equal(t, true, resp.Equal("application/json "))
+		}(i)
+	}
+	wg.Wait()
+	require.Equal(t, "application/json", client.GetHeader("Accept"))
+}
+
+func TestWithRequestContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	client := NewClient(
+		WithContext(context.Background()),
+		SetRetry(3),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := client.Get(server.URL, nil, WithRequestContext(ctx))
+	require.NotNil(t, err)
+	require.Equal(t, true, errors.Is(err, context.Canceled))
+	require.Less(t, time.Since(start), 400*time.Millisecond)
+}
+
+func TestWithRequestTimeout(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 || r.URL.Path == "/slow" {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	client := NewClient()
+	_, err := client.Get(server.URL+"/slow", nil, WithRequestTimeout(50*time.Millisecond))
+	require.NotNil(t, err)
+	require.Equal(t, true, errors.Is(err, context.DeadlineExceeded))
+
+	atomic.StoreInt32(&attempts, 0)
+	client = NewClient(SetRetry(1))
+	resp, err := client.Get(server.URL, nil, WithRequestTimeout(50*time.Millisecond))
+	require.Nil(t, err)
+	require.Equal(t, true, resp.Equal("ok"))
+	require.Equal(t, int32(2), atomic.LoadInt32(&attempts))
+}
+
+func TestWithPathParam(t *testing.T) {
+	r := newRequest("GET", "/users/{user}/orders/{order}?q={raw}", nil,
+		WithPathParam("user", "a/b"),
+		WithPathParam("order", "张 三"),
+	)
+	require.Nil(t, r.expandPath())
+	require.Equal(t, "/users/a%2Fb/orders/%E5%BC%A0%20%E4%B8%89?q={raw}", r.url)
+
+	r = newRequest("GET", "/users/{user}/orders/{order}", nil, WithPathParam("user", "42"))
+	err := r.expandPath()
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "{order}")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.EscapedPath()))
+	}))
+	defer server.Close()
+	client := NewClient(WithBaseURL(server.URL))
+
+	resp, err := client.Get("/users/{user}", nil, WithPathParam("user", "a/b c"))
+	require.Nil(t, err)
+	require.Equal(t, true, resp.Equal("/users/a%2Fb%20c"))
+
+	_, err = client.Get("/users/{user}", nil)
+	require.NotNil(t, err)
+}
+
+func TestAddParamsMap(t *testing.T) {
+	r := newRequest("GET", "https://example.com/search", nil,
+		AddParamsMap(map[string]string{"q": "a b", "page": "2", "size": "10"}),
+		AddParams("lang", "en"),
+	)
+	require.Equal(t, "https://example.com/search?lang=en&page=2&q=a+b&size=10", r.buildURL())
+
+	r = newRequest("GET", "https://example.com/search", nil, AddParamsMap(map[string]string{}))
+	require.Equal(t, "https://example.com/search", r.buildURL())
+}
+
+func TestAddParamsList(t *testing.T) {
+	r := newRequest("GET", "https://example.com/items", nil,
+		AddParams("page", "1"),
+		AddParamsList("id", "1", "2", "3"),
+		AddParams("a", "x&y"),
+	)
+	require.Equal(t, "https://example.com/items?a=x%26y&id=1&id=2&id=3&page=1", r.buildURL())
+
+	r = newRequest("GET", "https://example.com/items", nil, AddParamsList("id"))
+	require.Equal(t, "https://example.com/items", r.buildURL())
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		keys     []string
+		attempts int32
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		mu.Unlock()
+		if atomic.AddInt32(&attempts, 1)%3 != 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	client := NewClient(SetRetry(2), WithAutoIdempotencyKey())
+
+	resp, err := client.Post(server.URL, nil)
+	require.Nil(t, err)
+	require.Len(t, keys, 3)
+	require.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, keys[0])
+	require.Equal(t, keys[0], keys[2])
+	require.Equal(t, keys[0], resp.IdempotencyKey())
+
+	resp, err = client.Post(server.URL, nil)
+	require.Nil(t, err)
+	require.NotEqual(t, keys[0], resp.IdempotencyKey())
+
+	resp, err = client.Post(server.URL, nil, WithIdempotencyKey("order-1"))
+	require.Nil(t, err)
+	require.Equal(t, "order-1", keys[len(keys)-1])
+	require.Equal(t, "order-1", resp.IdempotencyKey())
+
+	// a key set by the caller wins over a generated one
+	resp, err = client.Post(server.URL, nil, WithReqHeader("Idempotency-Key", "mine"))
+	require.Nil(t, err)
+	require.Equal(t, "mine", keys[len(keys)-1])
+	require.Equal(t, "mine", resp.IdempotencyKey())
+
+	client = NewClient(SetRetry(2), WithAutoIdempotencyKey(), AddHeader("Idempotency-Key", "client-key"))
+	resp, err = client.Post(server.URL, nil)
+	require.Nil(t, err)
+	require.Equal(t, "client-key", keys[len(keys)-1])
+	require.Equal(t, "client-key", resp.IdempotencyKey())
+}
+
+func TestWithReqCookie(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var names []string
+		for _, cookie := range r.Cookies() {
+			names = append(names, cookie.Name+"="+cookie.Value)
+		}
+		_, _ = w.Write([]byte(strings.Join(names, ";")))
+	}))
+	defer server.Close()
+	client := NewClient()
+	client.AddCookie([]*http.Cookie{{Name: "client", Value: "1"}})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%2 == 0 {
+				resp, err := client.Get(server.URL, nil,
+					WithReqCookie(&http.Cookie{Name: "session", Value: "s1"}),
+					WithReqCookie(&http.Cookie{Name: "csrf", Value: "c1"}),
+				)
+				require.Nil(t, err)
+				require.Equal(t, true, resp.Equal("client=1;session=s1;csrf=c1"))
+				return
+			}
+			resp, err := client.Get(server.URL, nil)
+			require.Nil(t, err)
+			require.Equal(t, true, resp.Equal("client=1"))
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestWithReqBasicAuth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || username != "user" || password != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	client := NewClient(AddHeader("Authorization", "Bearer token"))
+
+	_, err := client.Get(server.URL, nil)
+	require.NotNil(t, err)
+
+	resp, err := client.Get(server.URL, nil, WithReqBasicAuth("user", "pass"))
+	require.Nil(t, err)
+	require.Equal(t, true, resp.Equal("ok"))
+}
+
+func TestWithStreamBody(t *testing.T) {
+	size := int64(100 * 1024 * 1024)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chunk := make([]byte, 64*1024)
+		for written := int64(0); written < size; written += int64(len(chunk)) {
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+	client := NewClient()
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	resp, err := client.Get(server.URL, nil, WithStreamBody(), WithRequestTimeout(10*time.Second))
+	require.Nil(t, err)
+	_, err = resp.Body()
+	require.Equal(t, true, errors.Is(err, ErrStreamBody))
+	require.Nil(t, resp.Bytes())
+	var v any
+	require.Equal(t, true, errors.Is(resp.JSON(&v), ErrStreamBody))
+
+	reader := resp.Reader()
+	n, err := io.CopyBuffer(io.Discard, reader, make([]byte, 32*1024))
+	require.Nil(t, err)
+	require.Equal(t, size, n)
+	require.Nil(t, reader.Close())
+	runtime.ReadMemStats(&after)
+	require.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(16*1024*1024))
+}
+
+func TestWithBasicAuth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer server.Close()
+	client := NewClient(AddHeader("Authorization", "Bearer client"), WithBasicAuth("user", "pass"))
+
+	resp, err := client.Get(server.URL, nil)
+	require.Nil(t, err)
+	require.Equal(t, "Basic dXNlcjpwYXNz", resp.String())
+	resp, err = client.Get(server.URL, nil, WithReqBasicAuth("other", "secret"))
+	require.Nil(t, err)
+	require.Equal(t, "Basic b3RoZXI6c2VjcmV0", resp.String())
+	resp, err = client.Get(server.URL, nil, WithReqHeader("Authorization", "Bearer request"))
+	require.Nil(t, err)
+	require.Equal(t, "Bearer request", resp.String())
+}
@@ -1,15 +1,29 @@
 package jhttp
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/tidwall/gjson"
 )
 
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+var ErrStreamBody = errors.New("body is streamed, read it from Reader")
+
 var (
 	ReadSize    = 1024 * 1024       // 1 MB
 	MaxReadSize = 1024 * 1024 * 100 // 100 MB
@@ -23,80 +37,460 @@ func SetMaxReadSize(size int) {
 	MaxReadSize = size
 }
 
+// Result is a response, its body is buffered once and can then be read any
+// number of times: Bytes, String, BodyReader and the decoders all share the
+// same stored bytes. With WithStreamBody the body is read only once through
+// Reader and the buffered accessors report ErrStreamBody.
 type Result struct {
-	resp  *http.Response
-	cache []byte
+	resp       *http.Response
+	cache      []byte
+	statusCode int
+	status     string
+	header     http.Header
+	tls        *tls.ConnectionState
+	// method and url of the request that produced the response, after
+	// redirects
+	method string
+	url    string
+	// urls that redirected to url
+	redirects []string
+	// the body was converted to UTF-8 from another charset
+	converted bool
+	// stream is the unread response body in streaming mode
+	stream *streamBody
+	// duration of the last attempt, and of all attempts
+	duration      time.Duration
+	totalDuration time.Duration
+	attempts      int
+	traceInfo     *TraceInfo
+	// idempotency key sent with the request, if any
+	idempotencyKey string
+	// unmarshal is the JSON decoder of WithJSONCodec, json.Unmarshal if nil
+	unmarshal func(data []byte, v any) error
+	// body converted once by String
+	stringOnce sync.Once
+	str        string
+	// body decoded once by Map and Slice
+	parseOnce sync.Once
+	parsed    any
+	parseErr  error
+	// body decoded once with exact numbers by the path getters
+	treeOnce sync.Once
+	tree     any
+	treeErr  error
 }
 
-func NewResult(resp *http.Response) (*Result, error) {
+// JsonTypeError is returned when the top-level JSON value of the body does not
+// have the expected type.
+type JsonTypeError struct {
+	Expected string
+	Actual   string
+}
+
+func (e *JsonTypeError) Error() string {
+	return fmt.Sprintf("json: expected top-level %s, got %s", e.Expected, e.Actual)
+}
+
+// streamBody closes the response body, releases the attempt context and
+// frees the concurrency slot of the attempt.
+type streamBody struct {
+	io.ReadCloser
+	cancel  context.CancelFunc
+	release func()
+}
+
+func (body *streamBody) Close() error {
+	err := body.ReadCloser.Close()
+	if body.cancel != nil {
+		body.cancel()
+	}
+	if body.release != nil {
+		body.release()
+	}
+	return err
+}
+
+func newResult(resp *http.Response) *Result {
 	var result Result
 	result.resp = resp
+	result.statusCode = resp.StatusCode
+	result.status = resp.Status
+	result.header = resp.Header
+	if result.header == nil {
+		result.header = http.Header{}
+	}
+	result.tls = resp.TLS
+	if resp.Request != nil {
+		result.method = resp.Request.Method
+		result.url = resp.Request.URL.String()
+		result.redirects = redirectChain(resp.Request)
+	}
+	return &result
+}
+
+// newStreamResult returns a Result that does not read the response body.
+func newStreamResult(resp *http.Response) *Result {
+	result := newResult(resp)
+	result.stream = &streamBody{ReadCloser: resp.Body}
+	return result
+}
+
+func NewResult(resp *http.Response) (*Result, error) {
+	return newBufferedResult(resp, int64(MaxReadSize))
+}
+
+// newBufferedResult reads at most limit bytes of the body, a larger body is
+// discarded and reported as ErrResponseTooLarge.
+func newBufferedResult(resp *http.Response, limit int64) (*Result, error) {
+	result := newResult(resp)
 	defer func() {
 		_ = resp.Body.Close()
 	}()
 
-	// cache the response body
+	// HEAD responses never carry a body
+	if resp.Request != nil && resp.Request.Method == "HEAD" {
+		return result, nil
+	}
+
+	// cache the response body, reading one byte past the limit to detect it
+	body := &io.LimitedReader{R: resp.Body, N: limit + 1}
 	readSlice := make([]byte, ReadSize)
 	var data []byte
-	var size int
-	var err error
-	for size, err = result.resp.Body.Read(readSlice); size != 0; size, err = result.resp.Body.Read(readSlice) {
+	for {
+		size, err := body.Read(readSlice)
 		data = append(data, readSlice[:size]...)
-		if len(data) > MaxReadSize {
-			return nil, fmt.Errorf("too many bytes to read")
+		if int64(len(data)) > limit {
+			return nil, ErrResponseTooLarge
+		}
+		if err == io.EOF {
+			break
 		}
-		if err != nil && err != io.EOF {
+		if err != nil {
 			return nil, err
 		}
 	}
-	if err != nil && err != io.EOF {
-		return nil, err
-	}
 	result.cache = data
-	return &result, nil
+	return result, nil
+}
+
+func (result *Result) attachCancel(cancel context.CancelFunc) bool {
+	if result.stream == nil {
+		return false
+	}
+	result.stream.cancel = cancel
+	return true
+}
+
+// Reader returns the body, in streaming mode it reads the response directly
+// and must be closed by the caller.
+func (result *Result) Reader() io.ReadCloser {
+	if result.stream != nil {
+		return result.stream
+	}
+	return io.NopCloser(bytes.NewReader(result.cache))
+}
+
+// BodyReader returns a fresh reader over the buffered body on every call. In
+// streaming mode the body cannot be re-read and the reader fails with
+// ErrStreamBody.
+func (result *Result) BodyReader() io.Reader {
+	if result.stream != nil {
+		return errReader{err: ErrStreamBody}
+	}
+	return bytes.NewReader(result.cache)
+}
+
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+// Close closes a streamed body, it does nothing for a buffered one.
+func (result *Result) Close() error {
+	if result.stream != nil {
+		return result.stream.Close()
+	}
+	return nil
 }
 
 func (result *Result) Body() ([]byte, error) {
+	if result.stream != nil {
+		return nil, ErrStreamBody
+	}
 	if len(result.cache) > 0 {
 		return result.cache, nil
 	}
 	return nil, fmt.Errorf("empty body to read")
 }
 
+// Bytes returns the buffered body, which is shared by every caller and must
+// not be modified. An empty or streamed body returns nil.
+func (result *Result) Bytes() []byte {
+	return result.cache
+}
+
+// String returns the buffered body as a string, converted only once.
+func (result *Result) String() string {
+	result.stringOnce.Do(func() {
+		result.str = string(result.cache)
+	})
+	return result.str
+}
+
 func (result *Result) JsonUnmarshal(v any) error {
+	return result.JSON(v)
+}
+
+// JSON decodes the buffered body into v, it can be called any number of times.
+func (result *Result) JSON(v any) error {
 	body, err := result.Body()
 	if err != nil {
 		return err
 	}
-	err = json.Unmarshal(body, v)
+	unmarshal := result.unmarshal
+	if unmarshal == nil {
+		unmarshal = json.Unmarshal
+	}
+	err = unmarshal(body, v)
+	if err != nil {
+		return fmt.Errorf("decode json: %w, body: %s", err, bodySnippet(body))
+	}
+	return nil
+}
+
+// ErrorJSON decodes the body of a failed (non-2xx) response into v.
+func (result *Result) ErrorJSON(v any) error {
+	if result.IsSuccess() {
+		return fmt.Errorf("not an error response: %s", result.Status())
+	}
+	return result.JSON(v)
+}
+
+// XML decodes the buffered body into v, a leading UTF-8 BOM is skipped and
+// charsets other than UTF-8 are reported as an error unless the body was
+// converted by WithCharsetConversion.
+func (result *Result) XML(v any) error {
+	body, err := result.Body()
 	if err != nil {
 		return err
 	}
+	decoder := xml.NewDecoder(bytes.NewReader(bytes.TrimPrefix(body, utf8BOM)))
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		// the declared charset is stale once the body is converted
+		if result.converted {
+			return input, nil
+		}
+		return nil, fmt.Errorf("unsupported xml charset: %s", charset)
+	}
+	err = decoder.Decode(v)
+	if err != nil {
+		return fmt.Errorf("decode xml: %w, body: %s", err, bodySnippet(body))
+	}
 	return nil
 }
 
-func (result *Result) Header() *http.Header {
-	return &result.resp.Header
+// Map decodes a JSON object body, the decoded value is cached and shared by
+// later calls, so it must not be modified.
+func (result *Result) Map() (map[string]any, error) {
+	v, err := result.parse()
+	if err != nil {
+		return nil, err
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, &JsonTypeError{Expected: "object", Actual: jsonKind(v)}
+	}
+	return m, nil
+}
+
+// Slice decodes a JSON array body, the decoded value is cached and shared by
+// later calls, so it must not be modified.
+func (result *Result) Slice() ([]any, error) {
+	v, err := result.parse()
+	if err != nil {
+		return nil, err
+	}
+	s, ok := v.([]any)
+	if !ok {
+		return nil, &JsonTypeError{Expected: "array", Actual: jsonKind(v)}
+	}
+	return s, nil
+}
+
+func (result *Result) parse() (any, error) {
+	result.parseOnce.Do(func() {
+		result.parseErr = result.JSON(&result.parsed)
+	})
+	return result.parsed, result.parseErr
+}
+
+func jsonKind(v any) string {
+	switch v.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	default:
+		return "null"
+	}
+}
+
+// SaveOption configures SaveToFile.
+type (
+	SaveOption  = func(*saveOptions)
+	saveOptions struct {
+		mode       fs.FileMode
+		createDirs bool
+	}
+)
+
+// WithFileMode sets the permission of the saved file, 0644 by default.
+func WithFileMode(mode fs.FileMode) SaveOption {
+	return func(options *saveOptions) {
+		options.mode = mode
+	}
+}
+
+// WithCreateDirs creates the missing parent directories of the saved file.
+func WithCreateDirs() SaveOption {
+	return func(options *saveOptions) {
+		options.createDirs = true
+	}
+}
+
+// SaveToFile writes the body to a temporary file next to path and renames it
+// into place, so a partially written file never appears under path. A
+// streamed body is copied without buffering and closed. Errors are the
+// underlying os errors.
+func (result *Result) SaveToFile(path string, opts ...SaveOption) (err error) {
+	options := saveOptions{mode: 0o644}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	defer func() {
+		_ = result.Close()
+	}()
+	dir := filepath.Dir(path)
+	if options.createDirs {
+		if err = os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	file, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(file.Name())
+		}
+	}()
+	if _, err = io.Copy(file, result.Reader()); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(file.Name(), options.mode); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
 }
 
+// Header returns the first value of the response header key, lookups are
+// case-insensitive.
+func (result *Result) Header(key string) string {
+	return result.header.Get(key)
+}
+
+// HeaderValues returns all values of the response header key.
+func (result *Result) HeaderValues(key string) []string {
+	return result.header.Values(key)
+}
+
+func (result *Result) Headers() http.Header {
+	return result.header
+}
+
+// Cookies returns the cookies set by the response Set-Cookie headers.
 func (result *Result) Cookies() []*http.Cookie {
-	return result.resp.Cookies()
+	resp := http.Response{Header: result.header}
+	return resp.Cookies()
 }
 
 func (result *Result) StatusCode() int {
-	return result.resp.StatusCode
+	return result.statusCode
 }
 
 func (result *Result) Status() string {
-	return result.resp.Status
+	return result.status
 }
 
 func (result *Result) ContentLength() int64 {
 	return result.resp.ContentLength
 }
 
+// Proto returns the protocol of the response, e.g. "HTTP/1.1" or "HTTP/2.0".
+func (result *Result) Proto() string {
+	return result.resp.Proto
+}
+
+// TLS returns the negotiated TLS connection state, including the version,
+// cipher suite and peer certificates, nil for plaintext connections.
+func (result *Result) TLS() *tls.ConnectionState {
+	return result.tls
+}
+
+// Method returns the method of the request that produced the response.
+func (result *Result) Method() string {
+	return result.method
+}
+
+// URL returns the URL actually sent, including the query string and after
+// following redirects.
+func (result *Result) URL() string {
+	return result.url
+}
+
+// Duration returns how long the attempt that produced the result took, from
+// sending the request until the body was read. In streaming mode it ends when
+// the response headers arrive.
+func (result *Result) Duration() time.Duration {
+	return result.duration
+}
+
+// TotalDuration returns the wall time of all attempts including the waits
+// between retries.
+func (result *Result) TotalDuration() time.Duration {
+	return result.totalDuration
+}
+
+// Attempts returns the number of attempts made, 1 when nothing was retried.
+func (result *Result) Attempts() int {
+	return result.attempts
+}
+
+// IdempotencyKey returns the Idempotency-Key sent with the request.
+func (result *Result) IdempotencyKey() string {
+	return result.idempotencyKey
+}
+
 func (result *Result) IsSuccess() bool {
-	return result.StatusCode() == http.StatusOK
+	return result.StatusCode() >= 200 && result.StatusCode() <= 299
 }
 
 func (result *Result) Contains(str string) bool {
@@ -129,3 +523,13 @@ func (result *Result) Get(path string) (*gjson.Result, error) {
 	val := gjson.Get(string(body), path)
 	return &val, nil
 }
+
+// snippetSize is the number of body bytes included in decode errors
+const snippetSize = 512
+
+func bodySnippet(body []byte) string {
+	if len(body) > snippetSize {
+		return string(body[:snippetSize]) + "..."
+	}
+	return string(body)
+}
@@ -0,0 +1,253 @@
+package jhttp
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newTestResult returns a 200 result of body, header holds key and value pairs.
+func newTestResult(t *testing.T, body string, header ...string) *Result {
+	h := http.Header{}
+	for i := 0; i+1 < len(header); i += 2 {
+		h.Add(header[i], header[i+1])
+	}
+	result, err := NewResult(&http.Response{
+		StatusCode: http.StatusOK,
+		Status:     "200 OK",
+		Header:     h,
+		Body:       io.NopCloser(strings.NewReader(body)),
+	})
+	require.Nil(t, err)
+	return result
+}
+
+func TestResultJSON(t *testing.T) {
+	result := newTestResult(t, `{"key":"k1","value":"v1"}`)
+	var v MyStruct
+	require.Nil(t, result.JSON(&v))
+	require.Equal(t, MyStruct{Key: "k1", Value: "v1"}, v)
+	var again MyStruct
+	require.Nil(t, result.JSON(&again))
+	require.Equal(t, v, again)
+
+	result = newTestResult(t, `{"key":"k1",`+strings.Repeat(" ", 1024))
+	err := result.JSON(&v)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), `body: {"key":"k1",`)
+	require.Less(t, len(err.Error()), 700)
+
+	result = newTestResult(t, `[{"key":"k1"}]`)
+	err = result.JSON(&v)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), `body: [{"key":"k1"}]`)
+}
+
+func TestJSONCodec(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(body)
+	}))
+	defer server.Close()
+
+	// the codec tags what it encodes and only decodes tagged bodies
+	var decoded int32
+	marshal := func(v any) ([]byte, error) {
+		data, err := json.Marshal(v)
+		return append([]byte(`{"codec":true,"v":`), append(data, '}')...), err
+	}
+	unmarshal := func(data []byte, v any) error {
+		atomic.AddInt32(&decoded, 1)
+		var tagged struct {
+			Codec bool            `json:"codec"`
+			V     json.RawMessage `json:"v"`
+		}
+		if err := json.Unmarshal(data, &tagged); err != nil || !tagged.Codec {
+			return errors.New("untagged body")
+		}
+		return json.Unmarshal(tagged.V, v)
+	}
+	client := NewClient(WithJSONCodec(marshal, unmarshal))
+	require.Nil(t, client.Validate())
+
+	resp, err := client.Post(server.URL, map[string]any{"key": "k1", "count": 3})
+	require.Nil(t, err)
+	require.Equal(t, true, strings.HasPrefix(resp.String(), `{"codec":true,"v":`), resp.String())
+	var v MyStruct
+	require.Nil(t, resp.JSON(&v))
+	require.Equal(t, "k1", v.Key)
+	m, err := resp.Map()
+	require.Nil(t, err)
+	require.Equal(t, "k1", m["key"])
+	count, err := resp.GetInt("count")
+	require.Nil(t, err)
+	require.Equal(t, 3, count)
+	key, err := resp.GetString("key")
+	require.Nil(t, err)
+	require.Equal(t, "k1", key)
+	require.Equal(t, int32(3), atomic.LoadInt32(&decoded))
+
+	// the default client never calls the codec
+	resp, err = NewClient().Post(server.URL, map[string]any{"key": "k1"})
+	require.Nil(t, err)
+	require.Equal(t, `{"key":"k1"}`, resp.String())
+	require.Nil(t, resp.JSON(&v))
+	require.Equal(t, int32(3), atomic.LoadInt32(&decoded))
+
+	require.ErrorContains(t, NewClient(WithJSONCodec(nil, unmarshal)).Validate(), "WithJSONCodec: nil marshal or unmarshal")
+}
+
+type Feed struct {
+	XMLName xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string   `xml:"title"`
+	Links   []struct {
+		Href string `xml:"href,attr"`
+	} `xml:"http://www.w3.org/2005/Atom link"`
+	Location string `xml:"http://www.google.com/schemas/sitemap-image/1.1 loc"`
+}
+
+func TestResultXML(t *testing.T) {
+	body := `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom" xmlns:image="http://www.google.com/schemas/sitemap-image/1.1">
+	<title>jhttp</title>
+	<link href="https://example.com/1"/>
+	<link href="https://example.com/2"/>
+	<image:loc>https://example.com/image.png</image:loc>
+</feed>`
+	var feed Feed
+	require.Nil(t, newTestResult(t, "\xEF\xBB\xBF"+body).XML(&feed))
+	require.Equal(t, "jhttp", feed.Title)
+	require.Len(t, feed.Links, 2)
+	require.Equal(t, "https://example.com/2", feed.Links[1].Href)
+	require.Equal(t, "https://example.com/image.png", feed.Location)
+
+	err := newTestResult(t, `<feed xmlns="http://example.com/other"><title>x</title></feed>`).XML(&feed)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "decode xml")
+
+	err = newTestResult(t, `<?xml version="1.0" encoding="GBK"?><feed xmlns="http://www.w3.org/2005/Atom"></feed>`).XML(&feed)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "unsupported xml charset: GBK")
+}
+
+func TestResultMap(t *testing.T) {
+	result := newTestResult(t, `{"k1":"v1","k2":{"k3":1}}`)
+	m, err := result.Map()
+	require.Nil(t, err)
+	require.Equal(t, "v1", m["k1"])
+	require.Equal(t, map[string]any{"k3": float64(1)}, m["k2"])
+	again, err := result.Map()
+	require.Nil(t, err)
+	require.Equal(t, m, again)
+	_, err = result.Slice()
+	var typeErr *JsonTypeError
+	require.Equal(t, true, errors.As(err, &typeErr))
+	require.Equal(t, "array", typeErr.Expected)
+	require.Equal(t, "object", typeErr.Actual)
+
+	result = newTestResult(t, `[1,"a",true]`)
+	s, err := result.Slice()
+	require.Nil(t, err)
+	require.Equal(t, []any{float64(1), "a", true}, s)
+	_, err = result.Map()
+	require.Equal(t, true, errors.As(err, &typeErr))
+	require.Equal(t, "array", typeErr.Actual)
+
+	_, err = newTestResult(t, `42`).Map()
+	require.Equal(t, true, errors.As(err, &typeErr))
+	require.Equal(t, "number", typeErr.Actual)
+
+	_, err = newTestResult(t, `{"k1":`).Map()
+	require.NotNil(t, err)
+	require.Equal(t, false, errors.As(err, &typeErr))
+}
+
+func TestResultBytes(t *testing.T) {
+	result := newTestResult(t, "")
+	require.Len(t, result.Bytes(), 0)
+	require.Equal(t, "", result.String())
+
+	result = newTestResult(t, "hello")
+	require.Equal(t, []byte("hello"), result.Bytes())
+	require.Equal(t, "hello", result.String())
+	require.Equal(t, "hello", result.String())
+
+	large := strings.Repeat("0123456789", ReadSize/10*5+3)
+	result = newTestResult(t, large)
+	require.Equal(t, len(large), len(result.Bytes()))
+	require.Equal(t, large, result.String())
+}
+
+func TestResultSaveToFile(t *testing.T) {
+	dir := t.TempDir()
+	result := newTestResult(t, "report")
+
+	path := filepath.Join(dir, "report.csv")
+	require.Nil(t, result.SaveToFile(path, WithFileMode(0o600)))
+	data, err := os.ReadFile(path)
+	require.Nil(t, err)
+	require.Equal(t, "report", string(data))
+	info, err := os.Stat(path)
+	require.Nil(t, err)
+	require.Equal(t, fs.FileMode(0o600), info.Mode().Perm())
+
+	nested := filepath.Join(dir, "a", "b", "report.csv")
+	err = result.SaveToFile(nested)
+	require.Equal(t, true, errors.Is(err, fs.ErrNotExist))
+	require.Nil(t, result.SaveToFile(nested, WithCreateDirs()))
+	data, err = os.ReadFile(nested)
+	require.Nil(t, err)
+	require.Equal(t, "report", string(data))
+
+	if os.Geteuid() != 0 {
+		readonly := filepath.Join(dir, "readonly")
+		require.Nil(t, os.Mkdir(readonly, 0o500))
+		err = result.SaveToFile(filepath.Join(readonly, "report.csv"))
+		require.Equal(t, true, errors.Is(err, fs.ErrPermission))
+	}
+
+	entries, err := os.ReadDir(dir)
+	require.Nil(t, err)
+	for _, entry := range entries {
+		require.Equal(t, false, strings.Contains(entry.Name(), ".tmp-"))
+	}
+}
+
+func TestResultBodyReader(t *testing.T) {
+	result := newTestResult(t, `{"key":"k1","value":"v1"}`)
+	for i := 0; i < 2; i++ {
+		data, err := io.ReadAll(result.BodyReader())
+		require.Nil(t, err)
+		require.Equal(t, `{"key":"k1","value":"v1"}`, string(data))
+	}
+	var v MyStruct
+	require.Nil(t, result.JSON(&v))
+	require.Equal(t, MyStruct{Key: "k1", Value: "v1"}, v)
+	m, err := result.Map()
+	require.Nil(t, err)
+	require.Equal(t, "k1", m["key"])
+	require.Equal(t, `{"key":"k1","value":"v1"}`, result.String())
+	require.Equal(t, `{"key":"k1","value":"v1"}`, string(result.Bytes()))
+
+	stream := newStreamResult(&http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader("streamed")),
+	})
+	_, err = io.ReadAll(stream.BodyReader())
+	require.Equal(t, true, errors.Is(err, ErrStreamBody))
+	data, err := io.ReadAll(stream.Reader())
+	require.Nil(t, err)
+	require.Equal(t, "streamed", string(data))
+}
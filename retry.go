@@ -0,0 +1,225 @@
+package jhttp
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// retry.go is used to decide when and how long to wait between attempts
+
+const (
+	defaultRetryWaitMin = 100 * time.Millisecond
+	defaultRetryWaitMax = 10 * time.Second
+)
+
+// WithRetryWait sets the exponential backoff between retries, the wait before
+// retry n is random between zero and min*2^n, capped at max. It defaults to
+// 100ms and 10s.
+func WithRetryWait(min, max time.Duration) ClientOption {
+	return func(client *Client) {
+		if min < 0 || max < min {
+			client.invalidOption("WithRetryWait", "invalid range %s-%s", min, max)
+		}
+		client.retryWaitMin, client.retryWaitMax = min, max
+	}
+}
+
+// WithRetryNonIdempotent retries POST and PATCH requests too. By default only
+// GET, HEAD, PUT, DELETE, OPTIONS and TRACE requests, and requests carrying an
+// Idempotency-Key, are retried, since a lost response may hide a request that
+// already succeeded. WithReqRetryable overrides this for a single request.
+func WithRetryNonIdempotent() ClientOption {
+	return func(client *Client) {
+		client.retryNonIdempotent = true
+	}
+}
+
+// WithReqRetryable decides whether a single request is retried, regardless of
+// its method. It has no effect without SetRetry.
+func WithReqRetryable(retryable bool) ParamsOption {
+	return func(r *request) {
+		r.retryable = &retryable
+	}
+}
+
+// retries returns how many times the request may be retried.
+func (c *Client) retries(r *request) int {
+	if r.retryable != nil {
+		if *r.retryable {
+			return c.retry
+		}
+		return 0
+	}
+	switch r.method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions, http.MethodTrace:
+		return c.retry
+	}
+	if c.retryNonIdempotent || r.idempotencyKey != "" || r.header.Get("Idempotency-Key") != "" || c.hasHeader("Idempotency-Key") {
+		return c.retry
+	}
+	return 0
+}
+
+// WithRetryCondition decides whether a failed attempt is retried. By default
+// every failure is retried except a 4xx status other than 408 and 429, and
+// ErrResponseTooLarge, which an oversized body fails with again. It is only
+// called for failed attempts, those the success check rejected included, and
+// never for a cancelled context. A rejected status comes as a *StatusError
+// holding the body, resp is nil unless the response became a Result, see
+// WithReturnResultOnError and WithSuccessCheck. A failure that is not retried
+// is returned as is.
+func WithRetryCondition(condition func(resp *Result, err error) bool) ClientOption {
+	return func(client *Client) {
+		client.retryCondition = condition
+	}
+}
+
+// WithMaxElapsedTime stops retrying when the next attempt would start more
+// than d after the first one, the request then fails with ErrRetryExhausted.
+// It never interrupts an attempt, see WithRequestTimeout for that.
+func WithMaxElapsedTime(d time.Duration) ClientOption {
+	return func(client *Client) {
+		if d < 0 {
+			client.invalidOption("WithMaxElapsedTime", "negative duration %s", d)
+			d = 0
+		}
+		client.maxElapsedTime = d
+	}
+}
+
+// overBudget reports whether waiting for wait would start the next attempt
+// past the WithMaxElapsedTime budget.
+func (c *Client) overBudget(start time.Time, wait time.Duration) bool {
+	return c.maxElapsedTime > 0 && c.clock().Sub(start)+wait > c.maxElapsedTime
+}
+
+// RetryInfo describes a retry the client is about to make.
+type RetryInfo struct {
+	// Attempt is the failed attempt, 1 for the first try
+	Attempt int
+	// Wait is how long the client waits before the next attempt
+	Wait time.Duration
+	// StatusCode is zero when no response was received
+	StatusCode int
+	Err        error
+	Method     string
+	// URL has its query redacted unless WithFullURLInErrors is set
+	URL string
+}
+
+// WithOnRetry calls hook every time a failed attempt is retried, before
+// waiting for the next attempt.
+func WithOnRetry(hook func(info RetryInfo)) ClientOption {
+	return func(client *Client) {
+		client.onRetry = hook
+	}
+}
+
+// notifyRetry calls the OnRetry hook, a panic in the hook is logged and the
+// request is retried anyway.
+func (c *Client) notifyRetry(r *request, attempt Attempt, wait time.Duration) {
+	if c.onRetry == nil {
+		return
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("jhttp: recovered panic in OnRetry hook: %v", p)
+		}
+	}()
+	c.onRetry(RetryInfo{
+		Attempt:    attempt.Attempt,
+		Wait:       wait,
+		StatusCode: attempt.StatusCode,
+		Err:        attempt.Err,
+		Method:     r.method,
+		URL:        c.errorURL(r.buildURL()),
+	})
+}
+
+// retryable reports whether a failed attempt is retried.
+func (c *Client) retryable(resp *Result, err error) bool {
+	if c.retryCondition != nil {
+		return c.retryCondition(resp, err)
+	}
+	if errors.Is(err, ErrResponseTooLarge) {
+		return false
+	}
+	code := 0
+	var statusErr *StatusError
+	if resp != nil {
+		code = resp.statusCode
+	} else if errors.As(err, &statusErr) {
+		code = statusErr.Code
+	}
+	switch {
+	case code == http.StatusRequestTimeout, code == http.StatusTooManyRequests:
+		return true
+	case code >= 400 && code < 500:
+		return false
+	}
+	return true
+}
+
+// WithBackoff decides the wait before the next retry instead of WithRetryWait.
+// It is called after attempt failed and WithRetryCondition decided to retry
+// it, and never after the last attempt. attempt is 1 for the first try, resp
+// is nil unless the response became a Result, see WithReturnResultOnError,
+// and its body is already closed. A negative wait stops retrying.
+func WithBackoff(backoff func(attempt int, resp *Result, err error) time.Duration) ClientOption {
+	return func(client *Client) {
+		client.backoff = backoff
+	}
+}
+
+// waitBeforeRetry returns the wait before retrying the failed attempt i,
+// false when the request is not retried anymore.
+func (c *Client) waitBeforeRetry(i, attempt int, start time.Time, resp *Result, err error) (time.Duration, bool) {
+	var wait time.Duration
+	if c.backoff != nil {
+		wait = c.backoff(attempt, resp, err)
+	} else {
+		wait = c.retryWait(i)
+	}
+	return wait, wait >= 0 && !c.overBudget(start, wait)
+}
+
+// retryWait returns the full jitter backoff after the failed attempt i.
+func (c *Client) retryWait(i int) time.Duration {
+	ceiling := c.retryWaitMin
+	for n := 0; n < i && ceiling < c.retryWaitMax; n++ {
+		ceiling *= 2
+	}
+	if ceiling > c.retryWaitMax {
+		ceiling = c.retryWaitMax
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	jitter := c.jitter
+	if jitter == nil {
+		jitter = defaultJitter
+	}
+	return time.Duration(jitter(int64(ceiling) + 1))
+}
+
+// sleepContext waits for d unless ctx is done first, then it returns the
+// context error.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// defaultJitter is rand.Int63n, safe for concurrent use.
+func defaultJitter(n int64) int64 {
+	return rand.Int63n(n)
+}
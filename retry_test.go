@@ -0,0 +1,378 @@
+package jhttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+// recordSleeps replaces the sleeper and jitter of client, the jitter always
+// picks the longest wait.
+func recordSleeps(client *Client) *[]time.Duration {
+	var sleeps []time.Duration
+	client.sleep = func(ctx context.Context, d time.Duration) error {
+		sleeps = append(sleeps, d)
+		return nil
+	}
+	client.jitter = func(n int64) int64 {
+		return n - 1
+	}
+	return &sleeps
+}
+
+func TestRetryWait(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := NewClient(SetRetry(4))
+	sleeps := recordSleeps(client)
+	_, err := client.Get(server.URL, nil)
+	require.NotNil(t, err)
+	require.Equal(t, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond}, *sleeps)
+
+	client = NewClient(SetRetry(3), WithRetryWait(time.Second, 3*time.Second))
+	sleeps = recordSleeps(client)
+	_, err = client.Get(server.URL, nil)
+	require.NotNil(t, err)
+	require.Equal(t, []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}, *sleeps)
+
+	// the jitter picks a wait up to the ceiling
+	client = NewClient(WithRetryWait(100*time.Millisecond, time.Second))
+	for i := 0; i < 100; i++ {
+		wait := client.retryWait(3)
+		require.GreaterOrEqual(t, wait, time.Duration(0))
+		require.LessOrEqual(t, wait, 800*time.Millisecond)
+	}
+	require.Equal(t, time.Duration(0), NewClient(WithRetryWait(0, 0)).retryWait(5))
+	require.NotNil(t, NewClient(WithRetryWait(time.Second, time.Millisecond)).Validate())
+}
+
+func TestBackoff(t *testing.T) {
+	count := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	var attempts, statuses []int
+	client := NewClient(SetRetry(4), WithBackoff(func(attempt int, resp *Result, err error) time.Duration {
+		attempts = append(attempts, attempt)
+		require.Nil(t, resp)
+		var statusErr *StatusError
+		require.ErrorAs(t, err, &statusErr)
+		statuses = append(statuses, statusErr.Code)
+		if attempt <= 2 {
+			return time.Second
+		}
+		return time.Duration(attempt) * 2 * time.Second
+	}))
+	sleeps := recordSleeps(client)
+	_, err := client.Get(server.URL, nil)
+	require.ErrorIs(t, err, ErrRetryExhausted)
+	require.Equal(t, 5, count)
+	require.Equal(t, []int{1, 2, 3, 4}, attempts)
+	require.Equal(t, []int{503, 503, 503, 503}, statuses)
+	require.Equal(t, []time.Duration{time.Second, time.Second, 6 * time.Second, 8 * time.Second}, *sleeps)
+
+	// a negative wait stops retrying
+	count = 0
+	client = NewClient(SetRetry(4), WithBackoff(func(attempt int, resp *Result, err error) time.Duration {
+		if attempt == 2 {
+			return -1
+		}
+		return 0
+	}))
+	sleeps = recordSleeps(client)
+	_, err = client.Get(server.URL, nil)
+	require.ErrorIs(t, err, ErrRetryExhausted)
+	require.Equal(t, 2, count)
+	require.Equal(t, []time.Duration{0}, *sleeps)
+}
+
+func TestRetryIdempotent(t *testing.T) {
+	count := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		client *Client
+		method string
+		opts   []ParamsOption
+		want   int
+	}{
+		{name: "get", client: NewClient(SetRetry(2)), method: http.MethodGet, want: 3},
+		{name: "put", client: NewClient(SetRetry(2)), method: http.MethodPut, want: 3},
+		{name: "post", client: NewClient(SetRetry(2)), method: http.MethodPost, want: 1},
+		{name: "patch", client: NewClient(SetRetry(2)), method: http.MethodPatch, want: 1},
+		{name: "non idempotent", client: NewClient(SetRetry(2), WithRetryNonIdempotent()), method: http.MethodPost, want: 3},
+		{name: "idempotency key", client: NewClient(SetRetry(2)), method: http.MethodPost, opts: []ParamsOption{WithIdempotencyKey("k")}, want: 3},
+		{name: "auto idempotency key", client: NewClient(SetRetry(2), WithAutoIdempotencyKey()), method: http.MethodPatch, want: 3},
+		{name: "idempotency header", client: NewClient(SetRetry(2)), method: http.MethodPost, opts: []ParamsOption{WithReqHeader("Idempotency-Key", "k")}, want: 3},
+		{name: "request retryable", client: NewClient(SetRetry(2)), method: http.MethodPost, opts: []ParamsOption{WithReqRetryable(true)}, want: 3},
+		{name: "request not retryable", client: NewClient(SetRetry(2)), method: http.MethodGet, opts: []ParamsOption{WithReqRetryable(false)}, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			count = 0
+			recordSleeps(tt.client)
+			_, err := tt.client.Do(tt.method, server.URL, nil, tt.opts...)
+			require.NotNil(t, err)
+			require.Equal(t, tt.want, count)
+			if tt.want == 1 {
+				require.NotErrorIs(t, err, ErrRetryExhausted)
+				var statusErr *StatusError
+				require.ErrorAs(t, err, &statusErr)
+			} else {
+				require.ErrorIs(t, err, ErrRetryExhausted)
+			}
+		})
+	}
+}
+
+func TestRetryCondition(t *testing.T) {
+	var count int
+	var statuses []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := statuses[count]
+		count++
+		w.WriteHeader(status)
+		if status == http.StatusTooManyRequests {
+			_, _ = w.Write([]byte(`{"transient":true}`))
+		}
+	}))
+	defer server.Close()
+
+	retryGateway := func(resp *Result, err error) bool {
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) {
+			switch statusErr.Code {
+			case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+				return true
+			}
+			return gjson.GetBytes(statusErr.Body, "transient").Bool()
+		}
+		return false
+	}
+	retryTransient := func(resp *Result, err error) bool {
+		if resp == nil {
+			return false
+		}
+		transient, err := resp.Get("transient")
+		return err == nil && transient.Bool()
+	}
+	tests := []struct {
+		name     string
+		opts     []ClientOption
+		statuses []int
+		want     int
+		success  bool
+	}{
+		{name: "default", statuses: []int{500, 500, 500}, want: 3},
+		{name: "gateway", opts: []ClientOption{WithRetryCondition(retryGateway)}, statuses: []int{502, 504, 200}, want: 3, success: true},
+		{name: "permanent", opts: []ClientOption{WithRetryCondition(retryGateway)}, statuses: []int{503, 500, 200}, want: 2},
+		{name: "transient body", opts: []ClientOption{WithRetryCondition(retryGateway)}, statuses: []int{429, 200}, want: 2, success: true},
+		{name: "result on error", opts: []ClientOption{WithRetryCondition(retryTransient), WithReturnResultOnError()}, statuses: []int{429, 400, 200}, want: 2},
+		{
+			name:     "success check",
+			opts:     []ClientOption{WithRetryCondition(retryTransient), WithSuccessCheck(func(result *Result) bool { return result.StatusCode() == http.StatusCreated })},
+			statuses: []int{429, 200, 201},
+			want:     2,
+		},
+		{
+			name:     "success check accepts",
+			opts:     []ClientOption{WithRetryCondition(func(*Result, error) bool { return true }), WithSuccessCheck(func(result *Result) bool { return result.StatusCode() < 500 })},
+			statuses: []int{502, 429},
+			want:     2,
+			success:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			count, statuses = 0, tt.statuses
+			client := NewClient(append([]ClientOption{SetRetry(2)}, tt.opts...)...)
+			recordSleeps(client)
+			_, err := client.Get(server.URL, nil)
+			require.Equal(t, tt.want, count)
+			require.Equal(t, tt.success, err == nil)
+		})
+	}
+}
+
+func TestRetryNoSleep(t *testing.T) {
+	count := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := NewClient()
+	sleeps := recordSleeps(client)
+	_, err := client.Get(server.URL, nil)
+	require.NotNil(t, err)
+	require.Equal(t, 1, count)
+	require.Empty(t, *sleeps)
+
+	// permanent failures are not retried
+	client = NewClient(SetRetry(3))
+	sleeps = recordSleeps(client)
+	_, err = client.Put(server.URL, map[string]any{"ch": make(chan int)})
+	require.ErrorContains(t, err, "marshal json body")
+	_, err = client.Get(server.URL+"/%zz", nil)
+	require.NotNil(t, err)
+	_, err = client.Do("BAD METHOD", server.URL, nil)
+	require.NotNil(t, err)
+	require.Equal(t, 1, count)
+	require.Empty(t, *sleeps)
+}
+
+func TestRetryWaitCancel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	client := NewClient(SetRetry(3), WithRetryWait(time.Minute, time.Minute))
+	client.jitter = func(n int64) int64 {
+		return n - 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := client.Get(server.URL, nil, WithRequestContext(ctx))
+	require.Less(t, time.Since(start), 500*time.Millisecond)
+	require.ErrorIs(t, err, context.Canceled)
+	require.NotErrorIs(t, err, ErrTimeout)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	_, err = client.Get(server.URL, nil, WithRequestContext(ctx))
+	require.Less(t, time.Since(start), 500*time.Millisecond)
+	require.ErrorIs(t, err, ErrTimeout)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestMaxElapsedTime(t *testing.T) {
+	// every attempt takes 3s on the fake clock
+	var elapsed int64
+	count := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count++
+		atomic.AddInt64(&elapsed, int64(3*time.Second))
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	start := time.Now()
+	client := NewClient(SetRetry(10), WithRetryWait(time.Second, time.Second), WithMaxElapsedTime(10*time.Second))
+	client.now = func() time.Time {
+		return start.Add(time.Duration(atomic.LoadInt64(&elapsed)))
+	}
+	client.sleep = func(ctx context.Context, d time.Duration) error {
+		atomic.AddInt64(&elapsed, int64(d))
+		return nil
+	}
+	client.jitter = func(n int64) int64 {
+		return n - 1
+	}
+	_, err := client.Get(server.URL, nil)
+	require.ErrorIs(t, err, ErrRetryExhausted)
+	var retryErr *RetryExhaustedError
+	require.ErrorAs(t, err, &retryErr)
+	// attempts start at 0s, 4s and 8s, the fourth would start at 12s
+	require.Equal(t, 3, count)
+	require.Len(t, retryErr.Attempts, 3)
+	require.Equal(t, 11*time.Second, retryErr.Elapsed)
+	// the attempts are timed by the same clock
+	for i, attempt := range retryErr.Attempts {
+		require.Equal(t, start.Add(time.Duration(i)*4*time.Second), attempt.Time)
+		require.Equal(t, 3*time.Second, attempt.Duration)
+	}
+
+	require.NotNil(t, NewClient(WithMaxElapsedTime(-time.Second)).Validate())
+}
+
+func TestOnRetry(t *testing.T) {
+	count := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count++
+		if count < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	var infos []RetryInfo
+	client := NewClient(SetRetry(3), WithOnRetry(func(info RetryInfo) {
+		infos = append(infos, info)
+		panic("hook")
+	}))
+	sleeps := recordSleeps(client)
+	resp, err := client.Get(server.URL+"/path?token=secret", nil)
+	require.Nil(t, err)
+	require.Equal(t, "ok", resp.String())
+	require.Len(t, infos, 2)
+	require.Equal(t, []time.Duration{infos[0].Wait, infos[1].Wait}, *sleeps)
+	for i, info := range infos {
+		require.Equal(t, i+1, info.Attempt)
+		require.Equal(t, http.StatusServiceUnavailable, info.StatusCode)
+		require.ErrorAs(t, info.Err, new(*StatusError))
+		require.Equal(t, http.MethodGet, info.Method)
+		require.Equal(t, server.URL+"/path", info.URL)
+	}
+	require.Equal(t, 100*time.Millisecond, infos[0].Wait)
+	require.Equal(t, 200*time.Millisecond, infos[1].Wait)
+}
+
+func TestRetryStatus(t *testing.T) {
+	count := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count++
+		status, _ := strconv.Atoi(r.URL.Query().Get("status"))
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		status int
+		want   int
+	}{
+		{status: http.StatusBadRequest, want: 1},
+		{status: http.StatusNotFound, want: 1},
+		{status: http.StatusConflict, want: 1},
+		{status: http.StatusRequestTimeout, want: 3},
+		{status: http.StatusTooManyRequests, want: 3},
+		{status: http.StatusInternalServerError, want: 3},
+		{status: http.StatusServiceUnavailable, want: 3},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.status), func(t *testing.T) {
+			count = 0
+			client := NewClient(SetRetry(2))
+			recordSleeps(client)
+			_, err := client.Get(server.URL, nil, AddParams("status", strconv.Itoa(tt.status)))
+			require.Equal(t, tt.want, count)
+			var statusErr *StatusError
+			require.ErrorAs(t, err, &statusErr)
+			require.Equal(t, tt.status, statusErr.Code)
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package jhttp
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// stats.go is used to count the requests of a client
+
+// ClientStats is a snapshot of the counters of a client. Requests that fail
+// before being sent, e.g. with an invalid url, are not counted.
+type ClientStats struct {
+	Requests  int64
+	Retries   int64
+	Successes int64
+	Failures  int64
+	// Failures by class, a failure is counted in exactly one of them
+	StatusFailures    int64
+	TimeoutFailures   int64
+	CanceledFailures  int64
+	CircuitFailures   int64
+	TransportFailures int64
+	// RateLimitWaits counts the attempts that waited for WithRateLimit,
+	// RateLimitWaiting those waiting now and RateLimitTokens the attempts that
+	// can start without waiting
+	RateLimitWaits   int64
+	RateLimitWaiting int64
+	RateLimitTokens  float64
+	// ConcurrencyWaits counts the attempts that waited for a slot of
+	// WithMaxConcurrency, for ConcurrencyWaitTime in total, InFlight are the
+	// slots in use
+	ConcurrencyWaits    int64
+	ConcurrencyWaitTime time.Duration
+	InFlight            int64
+}
+
+// clientStats holds the counters, they are only changed atomically.
+type clientStats struct {
+	requests          int64
+	retries           int64
+	successes         int64
+	statusFailures    int64
+	timeoutFailures   int64
+	canceledFailures  int64
+	circuitFailures   int64
+	transportFailures int64
+	rateLimitWaits    int64
+	// concurrencyWaitTime is a time.Duration
+	concurrencyWaits    int64
+	concurrencyWaitTime int64
+}
+
+// Stats returns a snapshot of the request counters, it is safe to call while
+// requests are in flight.
+func (c *Client) Stats() ClientStats {
+	s := c.counters()
+	stats := ClientStats{
+		Requests:            atomic.LoadInt64(&s.requests),
+		Retries:             atomic.LoadInt64(&s.retries),
+		Successes:           atomic.LoadInt64(&s.successes),
+		StatusFailures:      atomic.LoadInt64(&s.statusFailures),
+		TimeoutFailures:     atomic.LoadInt64(&s.timeoutFailures),
+		CanceledFailures:    atomic.LoadInt64(&s.canceledFailures),
+		CircuitFailures:     atomic.LoadInt64(&s.circuitFailures),
+		TransportFailures:   atomic.LoadInt64(&s.transportFailures),
+		RateLimitWaits:      atomic.LoadInt64(&s.rateLimitWaits),
+		ConcurrencyWaits:    atomic.LoadInt64(&s.concurrencyWaits),
+		ConcurrencyWaitTime: time.Duration(atomic.LoadInt64(&s.concurrencyWaitTime)),
+		InFlight:            int64(len(c.slots)),
+	}
+	if c.rateLimiter != nil {
+		stats.RateLimitTokens, stats.RateLimitWaiting = c.rateLimiter.state(c.clock())
+	}
+	stats.Failures = stats.StatusFailures + stats.TimeoutFailures + stats.CanceledFailures + stats.CircuitFailures + stats.TransportFailures
+	return stats
+}
+
+// zeroStats are the counters of a Client not made by NewClient, such clients
+// share them.
+var zeroStats clientStats
+
+// counters returns the counters of the client.
+func (c *Client) counters() *clientStats {
+	if c.stats == nil {
+		return &zeroStats
+	}
+	return c.stats
+}
+
+// countResult counts the outcome of a request.
+func (s *clientStats) countResult(err error) {
+	var statusErr *StatusError
+	switch {
+	case err == nil:
+		atomic.AddInt64(&s.successes, 1)
+	case errors.Is(err, ErrCircuitOpen):
+		atomic.AddInt64(&s.circuitFailures, 1)
+	case errors.Is(err, context.Canceled):
+		atomic.AddInt64(&s.canceledFailures, 1)
+	case errors.Is(err, ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		atomic.AddInt64(&s.timeoutFailures, 1)
+	case errors.As(err, &statusErr):
+		atomic.AddInt64(&s.statusFailures, 1)
+	default:
+		atomic.AddInt64(&s.transportFailures, 1)
+	}
+}
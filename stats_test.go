@@ -0,0 +1,60 @@
+package jhttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/flaky":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/slow":
+			time.Sleep(100 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(SetRetry(2))
+	client.sleep = func(context.Context, time.Duration) error {
+		return nil
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = client.Get(server.URL, nil)
+			_, _ = client.Get(server.URL+"/missing", nil)
+			_, _ = client.Get(server.URL+"/flaky", nil)
+		}()
+	}
+	wg.Wait()
+	_, _ = client.Get(server.URL+"/slow", nil, WithRequestTimeout(10*time.Millisecond), WithReqRetryable(false))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _ = client.Get(server.URL, nil, WithRequestContext(ctx))
+	_, _ = client.Get("http://127.0.0.1:0", nil, WithReqRetryable(false))
+	// never sent
+	_, _ = client.Get(server.URL+"/{id}", nil)
+
+	require.Equal(t, ClientStats{
+		Requests:          33,
+		Retries:           20,
+		Successes:         10,
+		Failures:          23,
+		StatusFailures:    20,
+		TimeoutFailures:   1,
+		CanceledFailures:  1,
+		TransportFailures: 1,
+	}, client.Stats())
+}
@@ -0,0 +1,164 @@
+package jhttp
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"os"
+)
+
+// tls.go is used to configure how servers are verified
+
+// WithTLSConfig sets the TLS configuration of the client, a copy of config is
+// used. It replaces what earlier TLS options set, later ones change the copy.
+func WithTLSConfig(config *tls.Config) ClientOption {
+	return func(client *Client) {
+		if config == nil {
+			client.invalidOption("WithTLSConfig", "nil config")
+			return
+		}
+		if transport := client.ownTransport("WithTLSConfig"); transport != nil {
+			transport.TLSClientConfig = config.Clone()
+		}
+	}
+}
+
+// WithRootCAs verifies servers with the certificates of pool instead of the
+// system roots.
+func WithRootCAs(pool *x509.CertPool) ClientOption {
+	return func(client *Client) {
+		if config := client.tlsConfig("WithRootCAs"); config != nil {
+			config.RootCAs = pool
+		}
+	}
+}
+
+// WithRootCAFile verifies servers with the PEM certificates of the file at path
+// instead of the system roots. A missing file or one without any certificate
+// is an invalid option, see NewClientE, and fails closed: no server is then
+// trusted.
+func WithRootCAFile(path string) ClientOption {
+	return func(client *Client) {
+		pool := x509.NewCertPool()
+		if data, err := os.ReadFile(path); err != nil {
+			client.invalidOption("WithRootCAFile", "%v", err)
+		} else if !pool.AppendCertsFromPEM(data) {
+			client.invalidOption("WithRootCAFile", "no certificate in %s", path)
+		}
+		if config := client.tlsConfig("WithRootCAFile"); config != nil {
+			config.RootCAs = pool
+		}
+	}
+}
+
+// WithClientCert presents the certificate of certFile and keyFile, both PEM
+// encoded, to servers asking for one, e.g. for mutual TLS.
+func WithClientCert(certFile, keyFile string) ClientOption {
+	return func(client *Client) {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			client.invalidOption("WithClientCert", "load %s and %s: %v", certFile, keyFile, err)
+			return
+		}
+		if config := client.tlsConfig("WithClientCert"); config != nil {
+			config.Certificates = append(config.Certificates, cert)
+		}
+	}
+}
+
+// WithClientCertificate presents cert to servers asking for a certificate,
+// e.g. for mutual TLS.
+func WithClientCertificate(cert tls.Certificate) ClientOption {
+	return func(client *Client) {
+		if config := client.tlsConfig("WithClientCertificate"); config != nil {
+			config.Certificates = append(config.Certificates, cert)
+		}
+	}
+}
+
+// WithPinnedCertificates only accepts a server presenting a certificate, the
+// leaf or any other of its chain, whose public key matches one of pins. A pin
+// is the base64 SHA-256 of the SubjectPublicKeyInfo, as in HPKP. Other servers
+// fail the handshake with ErrPinMismatch.
+func WithPinnedCertificates(pins ...string) ClientOption {
+	return func(client *Client) {
+		client.pinCertificates("WithPinnedCertificates", pins, false)
+	}
+}
+
+// WithPinnedLeafCertificates is WithPinnedCertificates matching the leaf
+// certificate only.
+func WithPinnedLeafCertificates(pins ...string) ClientOption {
+	return func(client *Client) {
+		client.pinCertificates("WithPinnedLeafCertificates", pins, true)
+	}
+}
+
+// pinCertificates installs the pin check, invalid pins fail closed: no server
+// matches them, even when the client was created without NewClientE.
+func (c *Client) pinCertificates(option string, pins []string, leafOnly bool) {
+	hashes := map[[sha256.Size]byte]bool{}
+	for _, pin := range pins {
+		hash, err := base64.StdEncoding.DecodeString(pin)
+		if err != nil || len(hash) != sha256.Size {
+			c.invalidOption(option, "invalid pin %q", pin)
+			hashes = map[[sha256.Size]byte]bool{}
+			break
+		}
+		hashes[*(*[sha256.Size]byte)(hash)] = true
+	}
+	if len(pins) == 0 {
+		c.invalidOption(option, "no pins")
+	}
+	config := c.tlsConfig(option)
+	if config == nil {
+		return
+	}
+	verify := config.VerifyPeerCertificate
+	config.VerifyPeerCertificate = func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		if verify != nil {
+			if err := verify(rawCerts, verifiedChains); err != nil {
+				return err
+			}
+		}
+		for i, raw := range rawCerts {
+			if leafOnly && i > 0 {
+				break
+			}
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return err
+			}
+			if hashes[sha256.Sum256(cert.RawSubjectPublicKeyInfo)] {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w among %d presented certificates", ErrPinMismatch, len(rawCerts))
+	}
+}
+
+// WithInsecureSkipVerify accepts any server certificate and host name.
+//
+// DANGEROUS: anyone on the network can then read and change the requests,
+// only use it against a development server, never in production.
+func WithInsecureSkipVerify() ClientOption {
+	return func(client *Client) {
+		if config := client.tlsConfig("WithInsecureSkipVerify"); config != nil {
+			config.InsecureSkipVerify = true
+		}
+	}
+}
+
+// tlsConfig returns the TLS configuration of the own transport of the client.
+func (c *Client) tlsConfig(option string) *tls.Config {
+	transport := c.ownTransport(option)
+	if transport == nil {
+		return nil
+	}
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	return transport.TLSClientConfig
+}
@@ -0,0 +1,169 @@
+package jhttp
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTLSOptions(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.Nil(t, os.WriteFile(caFile, caPEM, 0o600))
+
+	_, err := NewClient().Get(server.URL, nil)
+	require.NotNil(t, err)
+
+	clients := map[string]*Client{
+		"root cas":      NewClient(WithRootCAs(pool)),
+		"root ca file":  NewClient(WithRootCAFile(caFile)),
+		"tls config":    NewClient(WithTLSConfig(&tls.Config{RootCAs: pool})),
+		"insecure":      NewClient(WithInsecureSkipVerify()),
+		"transport":     NewClient(WithTransport(&http.Transport{}), WithRootCAs(pool)),
+		"config and ca": NewClient(WithTLSConfig(&tls.Config{MinVersion: tls.VersionTLS12}), WithRootCAFile(caFile)),
+	}
+	for name, client := range clients {
+		require.Nil(t, client.Validate(), name)
+		resp, err := client.Get(server.URL, nil)
+		require.Nil(t, err, name)
+		require.Equal(t, "ok", resp.String(), name)
+	}
+	if config := http.DefaultTransport.(*http.Transport).TLSClientConfig; config != nil {
+		require.Nil(t, config.RootCAs)
+		require.Equal(t, false, config.InsecureSkipVerify)
+	}
+
+	badFile := filepath.Join(t.TempDir(), "bad.pem")
+	require.Nil(t, os.WriteFile(badFile, []byte("not a certificate"), 0o600))
+	_, err = NewClientE(WithRootCAFile(badFile))
+	require.ErrorContains(t, err, "WithRootCAFile: no certificate")
+	_, err = NewClientE(WithRootCAFile(filepath.Join(t.TempDir(), "missing.pem")))
+	require.ErrorContains(t, err, "WithRootCAFile")
+	// a bad file fails closed without NewClientE too, it trusts no server
+	for _, path := range []string{badFile, filepath.Join(t.TempDir(), "missing.pem")} {
+		_, err = NewClient(WithRootCAs(pool), WithRootCAFile(path)).Get(server.URL, nil)
+		var unknownAuthority x509.UnknownAuthorityError
+		require.ErrorAs(t, err, &unknownAuthority)
+	}
+	_, err = NewClientE(WithTransport(&countingTransport{}), WithInsecureSkipVerify())
+	require.ErrorContains(t, err, "WithInsecureSkipVerify: cannot configure a *jhttp.countingTransport transport")
+}
+
+// writeClientCert writes a self-signed client certificate and its key to dir.
+func writeClientCert(t *testing.T, dir string) (certFile, keyFile string, cert *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "jhttp client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.Nil(t, err)
+	cert, err = x509.ParseCertificate(der)
+	require.Nil(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.Nil(t, err)
+	certFile, keyFile = filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key")
+	require.Nil(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.Nil(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile, cert
+}
+
+func TestClientCert(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, cert := writeClientCert(t, dir)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(cert)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+
+	_, err := NewClient(WithRootCAs(pool)).Get(server.URL, nil)
+	require.NotNil(t, err)
+
+	keyPair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	require.Nil(t, err)
+	clients := map[string]*Client{
+		"files":       NewClient(WithRootCAs(pool), WithClientCert(certFile, keyFile)),
+		"certificate": NewClient(WithTLSConfig(&tls.Config{RootCAs: pool}), WithClientCertificate(keyPair)),
+	}
+	for name, client := range clients {
+		require.Nil(t, client.Validate(), name)
+		resp, err := client.Get(server.URL, nil)
+		require.Nil(t, err, name)
+		require.Equal(t, "jhttp client", resp.String(), name)
+	}
+
+	_, err = NewClientE(WithClientCert(certFile, filepath.Join(dir, "missing.key")))
+	require.ErrorContains(t, err, "WithClientCert: load "+certFile)
+	require.ErrorContains(t, err, "missing.key")
+}
+
+func TestPinnedCertificates(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+	hash := sha256.Sum256(server.Certificate().RawSubjectPublicKeyInfo)
+	pin := base64.StdEncoding.EncodeToString(hash[:])
+	otherHash := sha256.Sum256([]byte("other"))
+	otherPin := base64.StdEncoding.EncodeToString(otherHash[:])
+
+	for _, opt := range []ClientOption{WithPinnedCertificates(otherPin, pin), WithPinnedLeafCertificates(pin)} {
+		resp, err := NewClient(WithRootCAs(pool), opt).Get(server.URL, nil)
+		require.Nil(t, err)
+		require.Equal(t, "ok", resp.String())
+	}
+	// the pin is checked even without verifying the chain
+	resp, err := NewClient(WithInsecureSkipVerify(), WithPinnedCertificates(pin)).Get(server.URL, nil)
+	require.Nil(t, err)
+	require.Equal(t, "ok", resp.String())
+
+	_, err = NewClient(WithRootCAs(pool), WithPinnedCertificates(otherPin)).Get(server.URL, nil)
+	require.ErrorIs(t, err, ErrPinMismatch)
+	_, err = NewClient(WithInsecureSkipVerify(), WithPinnedLeafCertificates(otherPin)).Get(server.URL, nil)
+	require.ErrorIs(t, err, ErrPinMismatch)
+
+	// invalid pins fail closed without NewClientE too
+	for _, opt := range []ClientOption{WithPinnedCertificates("not-a-pin"), WithPinnedCertificates(pin, "not-a-pin"), WithPinnedLeafCertificates()} {
+		_, err = NewClient(WithRootCAs(pool), opt).Get(server.URL, nil)
+		require.ErrorIs(t, err, ErrPinMismatch)
+	}
+
+	_, err = NewClientE(WithPinnedCertificates("not a pin"))
+	require.ErrorContains(t, err, `WithPinnedCertificates: invalid pin "not a pin"`)
+	_, err = NewClientE(WithPinnedLeafCertificates())
+	require.ErrorContains(t, err, "WithPinnedLeafCertificates: no pins")
+}
@@ -0,0 +1,150 @@
+package jhttp
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// trace.go is used to measure the phases of a request with httptrace
+
+// TraceInfo is the timing breakdown of a request, phases that did not happen,
+// e.g. DNS and connect on a reused connection, are zero.
+type TraceInfo struct {
+	DNSLookup    time.Duration
+	Connect      time.Duration
+	TLSHandshake time.Duration
+	// TimeToFirstByte is measured from getting a connection until the first
+	// response byte, it includes writing the request.
+	TimeToFirstByte time.Duration
+	// ContentTransfer is measured from the first response byte until the body
+	// was read, zero in streaming mode.
+	ContentTransfer time.Duration
+	ConnReused      bool
+}
+
+// WithTrace records a TraceInfo for every request, see Result.Trace.
+func WithTrace() ClientOption {
+	return func(client *Client) {
+		client.trace = true
+	}
+}
+
+type tracer struct {
+	mu                  sync.Mutex
+	dnsStart, dnsDone   time.Time
+	connStart, connDone time.Time
+	tlsStart, tlsDone   time.Time
+	gotConn, firstByte  time.Time
+	reused              bool
+}
+
+func (t *tracer) record(at *time.Time) {
+	t.mu.Lock()
+	*at = time.Now()
+	t.mu.Unlock()
+}
+
+func (t *tracer) withTrace(req *http.Request) *http.Request {
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { t.record(&t.dnsStart) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { t.record(&t.dnsDone) },
+		ConnectStart: func(string, string) {
+			t.mu.Lock()
+			// keep the first attempt of a multi-address dial
+			if t.connStart.IsZero() {
+				t.connStart = time.Now()
+			}
+			t.mu.Unlock()
+		},
+		ConnectDone:       func(string, string, error) { t.record(&t.connDone) },
+		TLSHandshakeStart: func() { t.record(&t.tlsStart) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { t.record(&t.tlsDone) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			t.gotConn = time.Now()
+			t.reused = info.Reused
+			t.mu.Unlock()
+		},
+		GotFirstResponseByte: func() { t.record(&t.firstByte) },
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+}
+
+func (t *tracer) info(done time.Time, stream bool) *TraceInfo {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	info := &TraceInfo{ConnReused: t.reused}
+	if !t.reused {
+		info.DNSLookup = between(t.dnsStart, t.dnsDone)
+		info.Connect = between(t.connStart, t.connDone)
+		info.TLSHandshake = between(t.tlsStart, t.tlsDone)
+	}
+	info.TimeToFirstByte = between(t.gotConn, t.firstByte)
+	if !stream {
+		info.ContentTransfer = between(t.firstByte, done)
+	}
+	return info
+}
+
+func between(start, end time.Time) time.Duration {
+	if start.IsZero() || end.IsZero() || end.Before(start) {
+		return 0
+	}
+	return end.Sub(start)
+}
+
+// Trace returns the timing breakdown of the request, nil unless the client
+// was created with WithTrace.
+func (result *Result) Trace() *TraceInfo {
+	return result.traceInfo
+}
+
+// phaseTracker records the phase a request is in until its response headers
+// arrive, a phase is left only when it succeeded.
+type phaseTracker struct {
+	mu    sync.Mutex
+	phase string
+}
+
+func (p *phaseTracker) set(phase string) {
+	p.mu.Lock()
+	p.phase = phase
+	p.mu.Unlock()
+}
+
+func (p *phaseTracker) withTrace(req *http.Request) *http.Request {
+	trace := &httptrace.ClientTrace{
+		ConnectStart: func(string, string) { p.set(PhaseDial) },
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil {
+				p.set("")
+			}
+		},
+		TLSHandshakeStart: func() { p.set(PhaseTLSHandshake) },
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			if err == nil {
+				p.set("")
+			}
+		},
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			if info.Err == nil {
+				p.set(PhaseResponseHeader)
+			}
+		},
+		GotFirstResponseByte: func() { p.set("") },
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+}
+
+// wrap labels err with the phase the request failed in, if any.
+func (p *phaseTracker) wrap(err error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.phase == "" {
+		return err
+	}
+	return &PhaseError{Phase: p.phase, Err: err}
+}
@@ -0,0 +1,51 @@
+package jhttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithTrace(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	client := NewClient(WithTrace())
+	url := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+
+	resp, err := client.Get(url, nil)
+	require.Nil(t, err)
+	trace := resp.Trace()
+	require.NotNil(t, trace)
+	require.Equal(t, false, trace.ConnReused)
+	require.Greater(t, trace.DNSLookup, time.Duration(0))
+	require.Greater(t, trace.Connect, time.Duration(0))
+	require.Equal(t, time.Duration(0), trace.TLSHandshake)
+	require.GreaterOrEqual(t, trace.TimeToFirstByte, 20*time.Millisecond)
+	require.LessOrEqual(t, trace.TimeToFirstByte, resp.Duration())
+
+	resp, err = client.Get(url, nil)
+	require.Nil(t, err)
+	trace = resp.Trace()
+	require.Equal(t, true, trace.ConnReused)
+	require.Equal(t, time.Duration(0), trace.DNSLookup)
+	require.Equal(t, time.Duration(0), trace.Connect)
+	require.GreaterOrEqual(t, trace.TimeToFirstByte, 20*time.Millisecond)
+
+	tlsServer := httptest.NewTLSServer(server.Config.Handler)
+	defer tlsServer.Close()
+	client.http = tlsServer.Client()
+	resp, err = client.Get(tlsServer.URL, nil)
+	require.Nil(t, err)
+	require.Greater(t, resp.Trace().TLSHandshake, time.Duration(0))
+
+	resp, err = NewClient().Get(url, nil)
+	require.Nil(t, err)
+	require.Nil(t, resp.Trace())
+}
@@ -0,0 +1,215 @@
+package jhttp
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// transport.go is used to tune the connection pool of the client
+
+// the dialer settings of http.DefaultTransport
+const (
+	defaultDialTimeout = 30 * time.Second
+	defaultKeepAlive   = 30 * time.Second
+)
+
+// WithMaxIdleConns limits the idle connections kept for all hosts, zero means
+// no limit.
+func WithMaxIdleConns(n int) ClientOption {
+	return func(client *Client) {
+		if n < 0 {
+			client.invalidOption("WithMaxIdleConns", "negative count %d", n)
+			return
+		}
+		if transport := client.ownTransport("WithMaxIdleConns"); transport != nil {
+			transport.MaxIdleConns = n
+		}
+	}
+}
+
+// WithMaxIdleConnsPerHost limits the idle connections kept for each host, 2
+// by default. Raise it when many requests go to the same host.
+func WithMaxIdleConnsPerHost(n int) ClientOption {
+	return func(client *Client) {
+		if n < 0 {
+			client.invalidOption("WithMaxIdleConnsPerHost", "negative count %d", n)
+			return
+		}
+		if transport := client.ownTransport("WithMaxIdleConnsPerHost"); transport != nil {
+			transport.MaxIdleConnsPerHost = n
+		}
+	}
+}
+
+// WithMaxConnsPerHost limits the connections to each host, dialing or in use
+// included, zero means no limit. Requests over the limit wait for a
+// connection.
+func WithMaxConnsPerHost(n int) ClientOption {
+	return func(client *Client) {
+		if n < 0 {
+			client.invalidOption("WithMaxConnsPerHost", "negative count %d", n)
+			return
+		}
+		if transport := client.ownTransport("WithMaxConnsPerHost"); transport != nil {
+			transport.MaxConnsPerHost = n
+		}
+	}
+}
+
+// WithIdleConnTimeout closes connections idle for longer than d, zero means
+// never.
+func WithIdleConnTimeout(d time.Duration) ClientOption {
+	return func(client *Client) {
+		if d < 0 {
+			client.invalidOption("WithIdleConnTimeout", "negative duration %s", d)
+			return
+		}
+		if transport := client.ownTransport("WithIdleConnTimeout"); transport != nil {
+			transport.IdleConnTimeout = d
+		}
+	}
+}
+
+// WithDisableKeepAlives uses a new connection for every request, the request
+// is sent with Connection: close and its connection closed after the response.
+func WithDisableKeepAlives() ClientOption {
+	return func(client *Client) {
+		client.disableKeepAlives = true
+		if transport := client.ownTransport("WithDisableKeepAlives"); transport != nil {
+			transport.DisableKeepAlives = true
+		}
+	}
+}
+
+// WithForceHTTP1 never negotiates HTTP/2, every request is sent with HTTP/1.1.
+func WithForceHTTP1() ClientOption {
+	return func(client *Client) {
+		if transport := client.ownTransport("WithForceHTTP1"); transport != nil {
+			transport.ForceAttemptHTTP2 = false
+			// a non-nil empty map disables HTTP/2 over TLS
+			transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+			// the clone may already offer h2 to servers
+			client.tlsConfig("WithForceHTTP1").NextProtos = []string{"http/1.1"}
+		}
+	}
+}
+
+// WithH2C sends every request with HTTP/2 over cleartext TCP (h2c), for
+// servers that speak HTTP/2 without TLS. It replaces the transport, the TLS
+// and pool options cannot be combined with it.
+func WithH2C() ClientOption {
+	return func(client *Client) {
+		client.ownHTTP().Transport = &http2.Transport{
+			AllowHTTP: true,
+			// dial plain TCP for the http scheme
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, network, addr)
+			},
+		}
+	}
+}
+
+// WithUnixSocket sends every request over the unix domain socket at path, e.g.
+// /var/run/docker.sock. The host of the request url is only used for the Host
+// header, e.g. http://localhost/v1.41/containers/json.
+func WithUnixSocket(path string) ClientOption {
+	return func(client *Client) {
+		client.unixSocket = path
+		if transport := client.ownTransport("WithUnixSocket"); transport != nil {
+			// a proxy would be dialed through the socket too
+			transport.Proxy = nil
+			transport.DialContext = client.dialContext
+		}
+	}
+}
+
+// WithDialTimeout limits how long connecting to a host may take, 30s by
+// default, zero means no limit. SetTimeout and WithRequestTimeout still limit
+// the whole request, whichever ends first fails it. A failed connect is a
+// PhaseError with PhaseDial.
+func WithDialTimeout(d time.Duration) ClientOption {
+	return func(client *Client) {
+		if d < 0 {
+			client.invalidOption("WithDialTimeout", "negative duration %s", d)
+			return
+		}
+		client.dialTimeout = d
+		client.installDialer("WithDialTimeout")
+	}
+}
+
+// WithTLSHandshakeTimeout limits how long the TLS handshake with a host may
+// take, 10s by default, zero means no limit. A failed handshake is a
+// PhaseError with PhaseTLSHandshake.
+func WithTLSHandshakeTimeout(d time.Duration) ClientOption {
+	return func(client *Client) {
+		if d < 0 {
+			client.invalidOption("WithTLSHandshakeTimeout", "negative duration %s", d)
+			return
+		}
+		if transport := client.ownTransport("WithTLSHandshakeTimeout"); transport != nil {
+			transport.TLSHandshakeTimeout = d
+		}
+	}
+}
+
+// WithResponseHeaderTimeout limits how long to wait for the response headers
+// after the request was written, zero, the default, means no limit. Reading
+// the body is not limited by it. A timeout is a PhaseError with
+// PhaseResponseHeader.
+func WithResponseHeaderTimeout(d time.Duration) ClientOption {
+	return func(client *Client) {
+		if d < 0 {
+			client.invalidOption("WithResponseHeaderTimeout", "negative duration %s", d)
+			return
+		}
+		if transport := client.ownTransport("WithResponseHeaderTimeout"); transport != nil {
+			transport.ResponseHeaderTimeout = d
+		}
+	}
+}
+
+// WithLocalAddr sends every request from the local address ip, e.g. to leave
+// through a given interface. A proxy is dialed from ip too, WithUnixSocket
+// takes precedence over it. An IPv4 address cannot reach IPv6 hosts and the
+// other way around.
+func WithLocalAddr(ip string) ClientOption {
+	return func(client *Client) {
+		addr := net.ParseIP(ip)
+		if addr == nil {
+			client.invalidOption("WithLocalAddr", "invalid ip %q", ip)
+			return
+		}
+		client.localAddr = addr
+		client.installDialer("WithLocalAddr")
+	}
+}
+
+// ownTransport returns the http.Transport of the client, cloning the shared
+// http.DefaultTransport or the one given to WithTransport first so it is never
+// modified. A custom RoundTripper cannot be configured, it is an invalid
+// option.
+func (c *Client) ownTransport(option string) *http.Transport {
+	httpClient := c.ownHTTP()
+	if httpClient.Transport != nil && httpClient.Transport == c.transport {
+		return c.transport
+	}
+	rt := httpClient.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	transport, ok := rt.(*http.Transport)
+	if !ok {
+		c.invalidOption(option, "cannot configure a %T transport", rt)
+		return nil
+	}
+	c.transport = transport.Clone()
+	httpClient.Transport = c.transport
+	return c.transport
+}
@@ -0,0 +1,253 @@
+package jhttp
+
+import (
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func TestPoolOptions(t *testing.T) {
+	client := NewClient(WithMaxIdleConns(50), WithMaxIdleConnsPerHost(20), WithMaxConnsPerHost(30), WithIdleConnTimeout(time.Minute))
+	require.Nil(t, client.Validate())
+	transport := client.http.Transport.(*http.Transport)
+	require.Equal(t, 50, transport.MaxIdleConns)
+	require.Equal(t, 20, transport.MaxIdleConnsPerHost)
+	require.Equal(t, 30, transport.MaxConnsPerHost)
+	require.Equal(t, time.Minute, transport.IdleConnTimeout)
+	defaultTransport := http.DefaultTransport.(*http.Transport)
+	require.NotSame(t, defaultTransport, transport)
+	require.Equal(t, 0, defaultTransport.MaxIdleConnsPerHost)
+	require.Equal(t, 0, defaultTransport.MaxConnsPerHost)
+
+	err := NewClient(WithMaxIdleConnsPerHost(-1), WithIdleConnTimeout(-time.Second)).Validate()
+	require.ErrorContains(t, err, "WithMaxIdleConnsPerHost: negative count -1")
+	require.ErrorContains(t, err, "WithIdleConnTimeout: negative duration -1s")
+}
+
+func TestPoolReuse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	client := NewClient(WithMaxIdleConnsPerHost(10), WithTrace())
+	for i := 0; i < 5; i++ {
+		resp, err := client.Get(server.URL, nil)
+		require.Nil(t, err)
+		require.Equal(t, i > 0, resp.Trace().ConnReused)
+	}
+}
+
+func TestDisableKeepAlives(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Header.Get("Connection")))
+	}))
+	defer server.Close()
+
+	clients := map[string]*Client{
+		"first": NewClient(WithDisableKeepAlives(), WithMaxIdleConnsPerHost(10), WithTrace()),
+		"last":  NewClient(WithTrace(), WithMaxIdleConnsPerHost(10), WithDisableKeepAlives()),
+		// a later transport still closes the connections
+		"transport": NewClient(WithDisableKeepAlives(), WithTransport(&http.Transport{}), WithTrace()),
+	}
+	for name, client := range clients {
+		for i := 0; i < 2; i++ {
+			resp, err := client.Get(server.URL, nil)
+			require.Nil(t, err, name)
+			require.Equal(t, "close", resp.String(), name)
+			require.Equal(t, false, resp.Trace().ConnReused, name)
+		}
+	}
+}
+
+func TestProtocols(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Proto))
+	})
+	server := httptest.NewUnstartedServer(handler)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+
+	resp, err := NewClient(WithRootCAs(pool)).Get(server.URL, nil)
+	require.Nil(t, err)
+	require.Equal(t, "HTTP/2.0", resp.Proto())
+	resp, err = NewClient(WithRootCAs(pool), WithForceHTTP1()).Get(server.URL, nil)
+	require.Nil(t, err)
+	require.Equal(t, "HTTP/1.1", resp.Proto())
+	require.Equal(t, "HTTP/1.1", resp.String())
+
+	h2cServer := httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+	defer h2cServer.Close()
+	resp, err = NewClient().Get(h2cServer.URL, nil)
+	require.Nil(t, err)
+	require.Equal(t, "HTTP/1.1", resp.Proto())
+	resp, err = NewClient(WithH2C()).Get(h2cServer.URL, nil)
+	require.Nil(t, err)
+	require.Equal(t, "HTTP/2.0", resp.Proto())
+	require.Equal(t, "HTTP/2.0", resp.String())
+
+	require.NotNil(t, NewClient(WithH2C(), WithMaxIdleConns(1)).Validate())
+}
+
+func TestUnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "jhttp.sock")
+	listener, err := net.Listen("unix", socket)
+	require.Nil(t, err)
+	count := 0
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count++
+		if count == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(r.Host + r.URL.Path + "?" + r.URL.RawQuery + " " + r.Header.Get("X-Test")))
+	}))
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	client := NewClient(WithUnixSocket(socket), WithBaseURL("http://docker"), SetRetry(1))
+	recordSleeps(client)
+	resp, err := client.Get("/v1.41/containers/json", nil, AddParams("all", "1"), WithReqHeader("X-Test", "yes"))
+	require.Nil(t, err)
+	require.Equal(t, "docker/v1.41/containers/json?all=1 yes", resp.String())
+	require.Equal(t, 2, resp.Attempts())
+}
+
+func TestPhaseTimeouts(t *testing.T) {
+	// a listener that accepts but never answers, neither the TLS handshake nor
+	// the request
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	silent := listener.Addr().String()
+	// a closed listener refuses connections
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	refused := "http://" + closed.Addr().String()
+	require.Nil(t, closed.Close())
+
+	tests := []struct {
+		name    string
+		client  *Client
+		url     string
+		phase   string
+		timeout bool
+	}{
+		{name: "dial", client: NewClient(WithDialTimeout(time.Second)), url: refused, phase: PhaseDial},
+		{name: "tls handshake", client: NewClient(WithTLSHandshakeTimeout(50 * time.Millisecond)), url: "https://" + silent, phase: PhaseTLSHandshake, timeout: true},
+		{name: "response header", client: NewClient(WithResponseHeaderTimeout(50 * time.Millisecond)), url: "http://" + silent, phase: PhaseResponseHeader, timeout: true},
+		// the overall timeout ends first
+		{name: "overall timeout", client: NewClient(WithResponseHeaderTimeout(time.Minute), SetTimeout(50*time.Millisecond)), url: "http://" + silent, phase: PhaseResponseHeader, timeout: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Nil(t, tt.client.Validate())
+			start := time.Now()
+			_, err := tt.client.Get(tt.url, nil)
+			require.NotNil(t, err)
+			require.Less(t, time.Since(start), 5*time.Second)
+			var phaseErr *PhaseError
+			require.Equal(t, true, errors.As(err, &phaseErr), err.Error())
+			require.Equal(t, tt.phase, phaseErr.Phase)
+			require.Contains(t, err.Error(), tt.phase+": ")
+			require.Equal(t, tt.timeout, errors.Is(err, ErrTimeout))
+		})
+	}
+
+	// a response is not labelled
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+	_, err = NewClient(WithDialTimeout(time.Second), WithResponseHeaderTimeout(time.Second)).Get(server.URL, nil)
+	var phaseErr *PhaseError
+	require.Equal(t, false, errors.As(err, &phaseErr))
+
+	client := NewClient(WithTLSHandshakeTimeout(time.Second), WithResponseHeaderTimeout(2*time.Second), WithDialTimeout(3*time.Second))
+	transport := client.http.Transport.(*http.Transport)
+	require.Equal(t, time.Second, transport.TLSHandshakeTimeout)
+	require.Equal(t, 2*time.Second, transport.ResponseHeaderTimeout)
+	require.Equal(t, 3*time.Second, client.dialTimeout)
+
+	err = NewClient(WithDialTimeout(-time.Second), WithTLSHandshakeTimeout(-time.Second), WithResponseHeaderTimeout(-time.Second)).Validate()
+	require.ErrorContains(t, err, "WithDialTimeout: negative duration -1s")
+	require.ErrorContains(t, err, "WithTLSHandshakeTimeout: negative duration -1s")
+	require.ErrorContains(t, err, "WithResponseHeaderTimeout: negative duration -1s")
+}
+
+func TestLocalAddr(t *testing.T) {
+	// 127.0.0.2 is a loopback address on linux, not everywhere
+	probe, err := net.Listen("tcp", "127.0.0.2:0")
+	if err != nil {
+		t.Skip("127.0.0.2 is not available:", err)
+	}
+	require.Nil(t, probe.Close())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, _ := net.SplitHostPort(r.RemoteAddr)
+		// a proxy is sent the absolute url
+		if r.URL.IsAbs() {
+			host = "proxy " + host
+		}
+		_, _ = w.Write([]byte(host))
+	}))
+	defer server.Close()
+	proxyURL, err := url.Parse(server.URL)
+	require.Nil(t, err)
+	socket := filepath.Join(t.TempDir(), "jhttp.sock")
+	listener, err := net.Listen("unix", socket)
+	require.Nil(t, err)
+	unixServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("unix"))
+	}))
+	unixServer.Listener = listener
+	unixServer.Start()
+	defer unixServer.Close()
+
+	tests := []struct {
+		name   string
+		client *Client
+		want   string
+	}{
+		{name: "default", client: NewClient(), want: "127.0.0.1"},
+		{name: "local addr", client: NewClient(WithLocalAddr("127.0.0.2")), want: "127.0.0.2"},
+		{name: "with resolver", client: NewClient(WithDNSCache(time.Minute), WithLocalAddr("127.0.0.2"), WithDialTimeout(time.Second)), want: "127.0.0.2"},
+		// the proxy is dialed from the local address
+		{name: "proxy", client: NewClient(WithTransport(&http.Transport{Proxy: http.ProxyURL(proxyURL)}), WithLocalAddr("127.0.0.2")), want: "proxy 127.0.0.2"},
+		// the unix socket takes precedence
+		{name: "unix socket", client: NewClient(WithLocalAddr("127.0.0.2"), WithUnixSocket(socket)), want: "unix"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Nil(t, tt.client.Validate())
+			resp, err := tt.client.Get(server.URL, nil)
+			require.Nil(t, err)
+			require.Equal(t, tt.want, resp.String())
+		})
+	}
+
+	_, err = NewClientE(WithLocalAddr("127.0.0"))
+	require.ErrorContains(t, err, `WithLocalAddr: invalid ip "127.0.0"`)
+}
@@ -0,0 +1,85 @@
+package jhttp
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// validate.go is used to report invalid client options
+
+// NewClientE is NewClient that rejects invalid options, see Client.Validate.
+func NewClientE(opts ...ClientOption) (*Client, error) {
+	client := NewClient(opts...)
+	if err := client.Validate(); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// Validate reports the invalid and conflicting options the client was built
+// with, every error names its option. NewClient ignores them and falls back
+// to sane values where it can.
+func (c *Client) Validate() error {
+	errs := append(optionErrors{}, c.optionErrs...)
+	if c.successCheck != nil && len(c.successStatuses) > 0 {
+		errs = append(errs, fmt.Errorf("WithSuccessCheck: conflicts with WithSuccessStatuses and WithSuccessRange"))
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+type optionErrors []error
+
+func (e optionErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return "invalid client options: " + strings.Join(msgs, "; ")
+}
+
+// invalidOption records an invalid option for Validate.
+func (c *Client) invalidOption(option, format string, args ...any) {
+	c.optionErrs = append(c.optionErrs, fmt.Errorf(option+": "+format, args...))
+}
+
+func validateBaseURL(base string) error {
+	u, err := url.Parse(base)
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("not an absolute url: %q", base)
+	}
+	return nil
+}
+
+// validHeaderKey reports whether key is an RFC 7230 token.
+func validHeaderKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+			continue
+		}
+		if !strings.ContainsRune("!#$%&'*+-.^_`|~", rune(c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// validHeaderValue reports whether value has no control characters but tab.
+func validHeaderValue(value string) bool {
+	for i := 0; i < len(value); i++ {
+		if c := value[i]; (c < ' ' && c != '\t') || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
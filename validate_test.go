@@ -0,0 +1,52 @@
+package jhttp
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []ClientOption
+		want string
+	}{
+		{name: "negative retry", opts: []ClientOption{SetRetry(-3)}, want: "SetRetry: negative retry count -3"},
+		{name: "header key", opts: []ClientOption{AddHeader("bad key\n", "v")}, want: `AddHeader: invalid header key "bad key\n"`},
+		{name: "header value", opts: []ClientOption{AddHeader("X-Key", "v\r\nX-Injected: 1")}, want: `AddHeader: invalid value for header "X-Key"`},
+		{name: "nil context", opts: []ClientOption{WithContext(nil)}, want: "WithContext: nil context"},
+		{name: "base url", opts: []ClientOption{WithBaseURL("://bad")}, want: "WithBaseURL: "},
+		{name: "relative base url", opts: []ClientOption{WithBaseURL("/api")}, want: `WithBaseURL: not an absolute url: "/api"`},
+		{name: "redirects", opts: []ClientOption{WithMaxRedirects(-1)}, want: "WithMaxRedirects: negative redirect count -1"},
+		{name: "success range", opts: []ClientOption{WithSuccessRange(299, 200)}, want: "WithSuccessRange: empty range 299-200"},
+		{
+			name: "conflict",
+			opts: []ClientOption{WithSuccessStatuses(200), WithSuccessCheck(func(*Result) bool { return true })},
+			want: "WithSuccessCheck: conflicts with WithSuccessStatuses",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewClientE(tt.opts...)
+			require.Nil(t, client)
+			require.NotNil(t, err)
+			require.Contains(t, err.Error(), tt.want)
+			require.NotNil(t, NewClient(tt.opts...).Validate())
+		})
+	}
+
+	client, err := NewClientE(
+		SetRetry(2),
+		AddHeader("Accept", "application/json"),
+		WithContext(context.Background()),
+		WithBaseURL("https://api.example.com/v1"),
+		WithSuccessRange(200, 299),
+	)
+	require.Nil(t, err)
+	require.NotNil(t, client)
+
+	err = NewClient(SetRetry(-1), AddHeader("", "v")).Validate()
+	require.Contains(t, err.Error(), "SetRetry: negative retry count -1; AddHeader: invalid header key \"\"")
+}